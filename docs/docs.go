@@ -0,0 +1,166 @@
+// Package docs contains helpers for serving the embedded API documentation
+// generated by proto/vfsgen.
+package docs
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Index defines the path, relative to the root of the docs filesystem, that
+// requests for the docs base path are redirected to (for example
+// "/v1.swagger.json"). If empty, the first "*.swagger.json" file found in the
+// root of the docs filesystem is used.
+var Index = ""
+
+// Favicon defines the icon served for "favicon.ico" requests. The default is
+// a 1x1 transparent PNG, which is enough to keep browsers from logging 404s.
+var Favicon = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4, 0x89, 0x00, 0x00, 0x00,
+	0x0b, 0x49, 0x44, 0x41, 0x54, 0x78, 0xda, 0x63, 0x60, 0x00, 0x02, 0x00,
+	0x00, 0x05, 0x00, 0x01, 0xe9, 0xfa, 0xdc, 0xd8, 0x00, 0x00, 0x00, 0x00,
+	0x49, 0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+// FaviconContentType defines the content type of the Favicon value.
+var FaviconContentType = "image/png"
+
+// SwaggerUI defines the base URL the Swagger UI page loads its assets from,
+// for example SwaggerUIDist. If empty, the default, no Swagger UI page is
+// served.
+var SwaggerUI = ""
+
+// SwaggerUIDist is the base URL of a pinned swagger-ui-dist release on unpkg,
+// to be assigned to SwaggerUI.
+const SwaggerUIDist = "https://unpkg.com/swagger-ui-dist@3.20.0"
+
+// SwaggerUICSSIntegrity and SwaggerUIJSIntegrity define the subresource
+// integrity hashes of the "swagger-ui.css" and "swagger-ui-bundle.js" assets,
+// so browsers refuse assets that don't match the pinned release. They can be
+// computed with:
+// `curl -s $SwaggerUI/swagger-ui.css | openssl dgst -sha384 -binary | openssl base64 -A`
+// and are prefixed with "sha384-".
+var (
+	SwaggerUICSSIntegrity = ""
+	SwaggerUIJSIntegrity  = ""
+)
+
+// Handler returns an http.Handler that serves the docs filesystem under the
+// given path prefix.
+//
+// Requests for the prefix itself are redirected to the Index document and
+// requests for "favicon.ico" under the prefix are answered with the Favicon
+// value. Requests for "ui" under the prefix are answered with a Swagger UI
+// page rendering the Index document if SwaggerUI is set. All other
+// requests are served from the filesystem, JSON documents with an
+// "application/json" content type.
+//
+// It can be mounted on a chi router with:
+// `router.Handle("/docs/*", docs.Handler(embedded_docs.Docs, "/docs"))`
+func Handler(fs http.FileSystem, prefix string) http.Handler {
+	base := strings.TrimRight(prefix, "/")
+	files := http.StripPrefix(base, http.FileServer(fs))
+	index := func() string {
+		if "" != Index {
+			return base + "/" + strings.TrimLeft(Index, "/")
+		}
+		if found := findIndex(fs); "" != found {
+			return base + found
+		}
+		return ""
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch name := strings.TrimPrefix(r.URL.Path, base); name {
+		case "", "/":
+			location := index()
+			if "" == location {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, location, http.StatusFound)
+		case "/favicon.ico":
+			FaviconHandler(w, r)
+		case "/ui", "/ui/":
+			location := index()
+			if "" == SwaggerUI || "" == location {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			swaggerUIPage.Execute(w, map[string]string{
+				"Assets":       strings.TrimRight(SwaggerUI, "/"),
+				"CSSIntegrity": SwaggerUICSSIntegrity,
+				"JSIntegrity":  SwaggerUIJSIntegrity,
+				"URL":          location,
+			})
+		default:
+			if strings.HasSuffix(name, ".json") {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			}
+			files.ServeHTTP(w, r)
+		}
+	})
+}
+
+// swaggerUIPage is the Swagger UI page template.
+var swaggerUIPage = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API documentation</title>
+<link rel="stylesheet" href="{{.Assets}}/swagger-ui.css"{{if .CSSIntegrity}} integrity="{{.CSSIntegrity}}"{{end}} crossorigin="anonymous">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}/swagger-ui-bundle.js"{{if .JSIntegrity}} integrity="{{.JSIntegrity}}"{{end}} crossorigin="anonymous"></script>
+<script>
+window.onload = function() {
+	SwaggerUIBundle({url: "{{.URL}}", dom_id: "#swagger-ui"});
+};
+</script>
+</body>
+</html>
+`))
+
+// FaviconHandler serves the Favicon value. It can be mounted at "/favicon.ico"
+// on the router to keep browser favicon requests out of the error logs.
+func FaviconHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", FaviconContentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "favicon.ico", time.Time{}, bytes.NewReader(Favicon))
+}
+
+// findIndex returns the path of the first "*.swagger.json" file in the root
+// of the docs filesystem, or an empty string if none exists.
+func findIndex(fs http.FileSystem) string {
+	dir, err := fs.Open("/")
+	if nil != err {
+		return ""
+	}
+	defer dir.Close()
+
+	files, err := dir.Readdir(-1)
+	if nil != err {
+		return ""
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".swagger.json") {
+			names = append(names, file.Name())
+		}
+	}
+	if 0 == len(names) {
+		return ""
+	}
+	sort.Strings(names)
+	return path.Join("/", names[0])
+}
@@ -2,10 +2,13 @@ package http
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
+	"reflect"
+	"strings"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
@@ -17,15 +20,145 @@ import (
 // (application/json), using "github.com/golang/protobuf/jsonpb". It
 // supports full protobuf functionality.
 //
+// If EncodeForm is set, it marshals into Form-Data too, for clients that
+// send "Accept: application/x-www-form-urlencoded". The gateway uses the
+// request marshaler for responses if the Accept header doesn't select
+// another one, so form requests without an Accept header then get form
+// responses as well. Messages are flattened into form fields with the same
+// names as their JSON representation: nested message fields use dotted keys,
+// e.g. "parent.id", repeated fields repeat the key and map fields use
+// bracketed keys, e.g. "labels[env]". This encoding doesn't round-trip in
+// all cases: messages nested in repeated fields or map values can't be told
+// apart, and the decoder only sets scalar map values.
+//
 // It can be added before the MIMEWildcard with:
 // `runtime.WithMarshalerOption("application/x-www-form-urlencoded", &runtime.Form{}),`
 type Form struct {
 	runtime.JSONPb
+	EncodeForm bool // EncodeForm if true will marshal into Form-Data instead of JSON
 }
 
 // Confirm *Form is a runtime.Marshaler
 var _ runtime.Marshaler = &Form{}
 
+// ContentType returns the Content-Type of marshalled data, Form-Data if
+// EncodeForm is set and JSON otherwise.
+func (j *Form) ContentType() string {
+	if j.EncodeForm {
+		return "application/x-www-form-urlencoded"
+	}
+	return j.JSONPb.ContentType()
+}
+
+// Marshal marshals "v" into Form-Data if EncodeForm is set, and into JSON
+// otherwise.
+func (j *Form) Marshal(v interface{}) ([]byte, error) {
+	if !j.EncodeForm {
+		return j.JSONPb.Marshal(v)
+	}
+	return j.encodeForm(v)
+}
+
+// NewEncoder returns an Encoder which writes Form-Data into "w" if EncodeForm
+// is set, and JSON otherwise. Stream messages are separated by the
+// delimiter, a newline.
+func (j *Form) NewEncoder(w io.Writer) runtime.Encoder {
+	if !j.EncodeForm {
+		return j.JSONPb.NewEncoder(w)
+	}
+	return runtime.EncoderFunc(func(v interface{}) error {
+		data, err := j.encodeForm(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// encodeForm marshals "v" into JSON, then flattens the JSON into form
+// values.
+func (j *Form) encodeForm(v interface{}) ([]byte, error) {
+	data, err := j.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	flattenForm(values, "", decoded, reflect.TypeOf(v))
+	return []byte(values.Encode()), nil
+}
+
+// flattenForm adds the JSON value "v" decoded with UseNumber to "values"
+// under "key", recursing into objects with dotted keys, into map fields with
+// bracketed keys and into arrays with repeated keys. "typ" is the Go type of
+// the value, used to tell map fields from messages, nil if unknown. Null
+// values are omitted.
+func flattenForm(values url.Values, key string, v interface{}, typ reflect.Type) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var fields map[string]reflect.Type
+		if nil != typ && reflect.Ptr == typ.Kind() && reflect.Struct == typ.Elem().Kind() {
+			fields = messageFields(typ.Elem())
+		}
+		for k, item := range v {
+			if nil != typ && reflect.Map == typ.Kind() {
+				flattenForm(values, key+"["+k+"]", item, typ.Elem())
+				continue
+			}
+			itemType := fields[k]
+			if "" != key {
+				k = key + "." + k
+			}
+			flattenForm(values, k, item, itemType)
+		}
+	case []interface{}:
+		var itemType reflect.Type
+		if nil != typ && reflect.Slice == typ.Kind() {
+			itemType = typ.Elem()
+		}
+		for _, item := range v {
+			flattenForm(values, key, item, itemType)
+		}
+	case nil:
+	case string:
+		values.Add(key, v)
+	default:
+		values.Add(key, fmt.Sprint(v))
+	}
+}
+
+// messageFields maps the JSON names and the original names of the fields of
+// a generated message struct, including all oneof members, to their types.
+func messageFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	props := proto.GetProperties(typ)
+	add := func(prop *proto.Properties, fieldType reflect.Type) {
+		fields[prop.OrigName] = fieldType
+		if "" != prop.JSONName {
+			fields[prop.JSONName] = fieldType
+		}
+	}
+	for i, prop := range props.Prop {
+		if strings.HasPrefix(prop.Name, "XXX_") || i >= typ.NumField() {
+			continue
+		}
+		if "" == typ.Field(i).Tag.Get("protobuf_oneof") {
+			add(prop, typ.Field(i).Type)
+		}
+	}
+	for _, oneof := range props.OneofTypes {
+		add(oneof.Prop, oneof.Type.Elem().Field(0).Type)
+	}
+	return fields
+}
+
 // Unmarshal unmarshals Form "data" into "v"
 func (j *Form) Unmarshal(data []byte, v interface{}) error {
 	return decodeForm(bytes.NewBuffer(data), v)
@@ -41,6 +174,15 @@ func (j *Form) NewDecoder(r io.Reader) runtime.Decoder {
 // decodeForm reads and parses form data from "r" by using
 // runtime.PopulateQueryParameters, then populates this into "v".
 // This method fails if "v" is not a proto.Message.
+//
+// Fields are matched by their proto or JSON name. Nested message fields are
+// set with dotted paths, e.g. "address.city=Paris", repeated fields by
+// repeating the key, e.g. "tags=a&tags=b", map fields with bracketed keys,
+// e.g. "labels[env]=prod", and enum fields by value name or number. Fields
+// of messages nested in repeated fields and message map values can't be
+// set. The utilities.DoubleArray passed to PopulateQueryParameters is a
+// filter of field paths to skip, such as path parameters, so an empty filter
+// populates every field.
 func decodeForm(d io.Reader, v interface{}) error {
 	msg, ok := v.(proto.Message)
 	if !ok {
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+func TestEncodeFormMap(t *testing.T) {
+	msg := &monitoredres.MonitoredResource{
+		Type:   "gce_instance",
+		Labels: map[string]string{"zone": "us-east1-b", "instance_id": "1"},
+	}
+	data, err := (&Form{EncodeForm: true}).Marshal(msg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	values, err := url.ParseQuery(string(data))
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"type":                {"gce_instance"},
+		"labels[zone]":        {"us-east1-b"},
+		"labels[instance_id]": {"1"},
+	}
+	if want.Encode() != values.Encode() {
+		t.Errorf("got %s, want %s", values.Encode(), want.Encode())
+	}
+
+	// map fields round-trip.
+	decoded := &monitoredres.MonitoredResource{}
+	if err := (&Form{}).Unmarshal(data, decoded); nil != err {
+		t.Fatal(err)
+	}
+	if !proto.Equal(msg, decoded) {
+		t.Errorf("decoded %v, want %v", decoded, msg)
+	}
+}
+
+func TestDecodeForm(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		form string
+		want *descriptor.FileDescriptorProto
+	}{
+		{
+			name: "scalar",
+			form: "name=a.proto&package=pkg",
+			want: &descriptor.FileDescriptorProto{Name: proto.String("a.proto"), Package: proto.String("pkg")},
+		},
+		{
+			name: "nested message",
+			form: "options.java_package=com.example&options.go_package=example",
+			want: &descriptor.FileDescriptorProto{Options: &descriptor.FileOptions{
+				JavaPackage: proto.String("com.example"),
+				GoPackage:   proto.String("example"),
+			}},
+		},
+		{
+			name: "repeated scalars",
+			form: "dependency=a.proto&dependency=b.proto&public_dependency=0&public_dependency=1",
+			want: &descriptor.FileDescriptorProto{
+				Dependency:       []string{"a.proto", "b.proto"},
+				PublicDependency: []int32{0, 1},
+			},
+		},
+		{
+			name: "enum by name",
+			form: "options.optimize_for=CODE_SIZE",
+			want: &descriptor.FileDescriptorProto{Options: &descriptor.FileOptions{
+				OptimizeFor: descriptor.FileOptions_CODE_SIZE.Enum(),
+			}},
+		},
+		{
+			name: "enum by number",
+			form: "options.optimize_for=3",
+			want: &descriptor.FileDescriptorProto{Options: &descriptor.FileOptions{
+				OptimizeFor: descriptor.FileOptions_LITE_RUNTIME.Enum(),
+			}},
+		},
+		{
+			name: "json name",
+			form: "publicDependency=2",
+			want: &descriptor.FileDescriptorProto{PublicDependency: []int32{2}},
+		},
+	} {
+		got := &descriptor.FileDescriptorProto{}
+		if err := (&Form{}).Unmarshal([]byte(test.form), got); nil != err {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !proto.Equal(test.want, got) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeFormErrors(t *testing.T) {
+	for name, form := range map[string]string{
+		"invalid number":   "public_dependency=x",
+		"invalid enum":     "options.optimize_for=FAST",
+		"invalid encoding": "name=%zz",
+	} {
+		if err := (&Form{}).Unmarshal([]byte(form), &descriptor.FileDescriptorProto{}); nil == err {
+			t.Errorf("%s: expected an error decoding %q", name, form)
+		}
+	}
+	if err := (&Form{}).Unmarshal([]byte("name=a"), struct{}{}); nil == err {
+		t.Error("expected an error decoding into a value that isn't a message")
+	}
+}
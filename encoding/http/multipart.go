@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+)
+
+// DefaultMultipartMaxSize is the default maximum size of a multipart request
+// body, 32MB.
+const DefaultMultipartMaxSize = 32 << 20
+
+// Multipart is a Marshaler which marshals from multipart form data
+// (multipart/form-data), and marshals into JSON (application/json), using
+// "github.com/golang/protobuf/jsonpb".
+//
+// Text fields are mapped to message fields by name like Form fields, e.g.
+// "name" or "parent.id". File parts are mapped by their form name to bytes
+// fields, holding the file contents. The whole body is held in memory, so
+// its size is limited to MaxSize.
+//
+// The grpc-gateway only selects it for requests whose Content-Type is
+// exactly "multipart/form-data", while clients always add the boundary
+// parameter, so the gateway handler must be wrapped by the
+// middleware.MediaType middleware, which NewRouter includes. The boundary is
+// then taken from the Content-Type header. Without the middleware, e.g. when
+// calling Unmarshal, it is read from the first boundary delimiter in the body.
+//
+// It can be added before the MIMEWildcard with:
+// `runtime.WithMarshalerOption("multipart/form-data", &http.Multipart{}),`
+type Multipart struct {
+	runtime.JSONPb
+	MaxSize int64 // MaxSize if greater than zero will limit the body size in bytes instead of DefaultMultipartMaxSize
+}
+
+// Confirm *Multipart is a runtime.Marshaler
+var _ runtime.Marshaler = &Multipart{}
+
+// Unmarshal unmarshals multipart "data" into "v"
+func (j *Multipart) Unmarshal(data []byte, v interface{}) error {
+	return j.decode(bytes.NewReader(data), v)
+}
+
+// NewDecoder returns a Decoder which reads multipart data from "r".
+func (j *Multipart) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		return j.decode(r, v)
+	})
+}
+
+// mediaTypeParams is implemented by request bodies carrying the parameters of
+// the request media type, see middleware.MediaType.
+type mediaTypeParams interface {
+	MediaTypeParam(name string) string
+}
+
+// decode reads and parses multipart data from "r", and populates the text
+// fields and base64 encoded file contents into "v" by using
+// runtime.PopulateQueryParameters. This method fails if "v" is not a
+// proto.Message.
+func (j *Multipart) decode(r io.Reader, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("not proto message")
+	}
+
+	maxSize := j.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMultipartMaxSize
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > maxSize {
+		return fmt.Errorf("multipart body exceeds %d bytes", maxSize)
+	}
+
+	boundary := ""
+	if body, ok := r.(mediaTypeParams); ok {
+		boundary = body.MediaTypeParam("boundary")
+	}
+	if "" == boundary {
+		if boundary, err = multipartBoundary(data); err != nil {
+			return err
+		}
+	}
+
+	values := url.Values{}
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if io.EOF == err {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := part.FormName()
+		if "" == name {
+			continue
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if "" != part.FileName() {
+			values.Add(name, base64.StdEncoding.EncodeToString(content))
+			continue
+		}
+		values.Add(name, string(content))
+	}
+
+	return runtime.PopulateQueryParameters(msg, values, &utilities.DoubleArray{})
+}
+
+// multipartBoundary returns the boundary of the first boundary delimiter line
+// in a multipart body, skipping any preamble.
+func multipartBoundary(data []byte) (string, error) {
+	for 0 < len(data) {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		line = bytes.TrimRight(line, " \t\r")
+		if bytes.HasPrefix(line, []byte("--")) && 2 < len(line) {
+			return string(line[2:]), nil
+		}
+	}
+	return "", fmt.Errorf("no multipart boundary found")
+}
@@ -1,14 +1,24 @@
 // Package jsonpb defines a protobuf JSON marshaller and registers it as the
-// default gRPC encoder.
+// gRPC codec named "json".
+//
+// The codec is used for calls with the "application/grpc+json" content-type,
+// made by clients dialed with DialOption. It doesn't replace the binary
+// protobuf codec, named "proto", which remains the default for all other
+// calls; see the encoding/proto package.
 package jsonpb
 
 import (
 	"bytes"
 	"encoding/json"
+	"reflect"
+	"unicode/utf8"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
 )
 
 func init() {
@@ -20,43 +30,219 @@ var defaultOpts = jsonpb.Marshaler{
 	OrigName:     true,
 }
 
+// defaultUnmarshalOpts ignores unknown fields, so clients built against an
+// older or newer version of a message can still call the service. They are
+// used by Register, and by RegisterConfig and NewCodec if Config.Unmarshaler
+// is nil.
+var defaultUnmarshalOpts = jsonpb.Unmarshaler{
+	AllowUnknownFields: true,
+}
+
+// Collections defines how empty repeated and map fields are rendered,
+// independently of how scalar and message default values are rendered.
+type Collections int
+
+const (
+	// CollectionsDefault renders empty repeated and map fields like any other
+	// default value: they are emitted if EmitDefaults is set and omitted
+	// otherwise.
+	CollectionsDefault Collections = iota
+
+	// CollectionsOmit omits empty repeated and map fields even if EmitDefaults
+	// is set. Scalar and message defaults are still emitted. With
+	// EmitDefaults set, a message with an empty string field name and an empty
+	// repeated field tags renders as
+	//
+	//	{"name":""}
+	//
+	// instead of
+	//
+	//	{"name":"","tags":[]}
+	CollectionsOmit
+
+	// CollectionsEmit emits empty repeated fields as [] and empty map fields as
+	// {} even if EmitDefaults is not set. Scalar and message defaults are
+	// still omitted. Without EmitDefaults, the message above renders as
+	//
+	//	{"tags":[]}
+	//
+	// instead of
+	//
+	//	{}
+	CollectionsEmit
+)
+
+// Config defines the JSON codec options.
+//
+// EmptyCollections applies to every message in the response, including
+// nested messages, repeated message fields and message map values. It does
+// not apply to the contents of well-known types such as google.protobuf.Any
+// or google.protobuf.Struct, which are always rendered by jsonpb. Set oneof
+// members are always emitted. Non-default EmptyCollections values require a
+// second pass over the marshaled JSON.
+//
+// FieldName, if set, replaces the field names chosen by Marshaler.OrigName:
+// every message field is rendered with the key FieldName returns for its
+// proto field name, e.g. "display_name" or "DisplayName", and input keys are
+// mapped back to the proto field names. Input keys that don't match a
+// renamed field are passed to jsonpb unchanged, so the proto and lowerCamelCase
+// names are still accepted. For the round trip to work, FieldName must be
+// invertible: it must return distinct names for the distinct fields of a
+// message. Field names inside well-known types are not renamed.
+//
+// Name, if set, registers the codec under another name than "json", so that
+// codecs with different options can be registered side by side, e.g. a
+// "json-strict" codec rejecting unknown fields. Clients select a codec by
+// name with the grpc.CallContentSubtype call option, and servers use the
+// codec named by the content-type of each call.
+type Config struct {
+	EmptyCollections Collections              // EmptyCollections defines how empty repeated and map fields are rendered
+	FieldName        func(name string) string // FieldName if set transforms the proto field names of the JSON keys
+	Marshaler        jsonpb.Marshaler         // Marshaler defines the jsonpb marshaling options
+	Name             string                   // Name if set registers the codec under this name instead of "json"
+	Unmarshaler      *jsonpb.Unmarshaler      // Unmarshaler if set defines the jsonpb unmarshaling options, otherwise unknown fields are ignored
+}
+
 // Register provides a way to override the jsonpb.Marshaler default values.
-// This is not thread-safe outside of init() routines.
+// Unknown fields in the input are ignored; use RegisterConfig to configure
+// the unmarshaling options as well. This is not thread-safe outside of
+// init() routines.
 func Register(opts jsonpb.Marshaler) {
-	encoding.RegisterCodec(jsonMarshaler{
-		Marshaler: opts,
-	})
+	RegisterConfig(Config{Marshaler: opts})
+}
+
+// RegisterConfig registers the JSON codec with the given configuration. This
+// is not thread-safe outside of init() routines: codecs are read from the
+// registry for every call, so all codecs should be registered at startup,
+// and differently configured codecs registered under their own names rather
+// than replaced while serving.
+func RegisterConfig(conf Config) {
+	encoding.RegisterCodec(NewCodec(conf))
+}
+
+// NewCodec returns a JSON codec with the given configuration, without
+// registering it.
+func NewCodec(conf Config) encoding.Codec {
+	name := conf.Name
+	if "" == name {
+		name = Name
+	}
+	unmarshaler := defaultUnmarshalOpts
+	if nil != conf.Unmarshaler {
+		unmarshaler = *conf.Unmarshaler
+	}
+	return jsonMarshaler{
+		Marshaler:   conf.Marshaler,
+		Unmarshaler: unmarshaler,
+		collections: conf.EmptyCollections,
+		fieldName:   conf.FieldName,
+		name:        name,
+	}
+}
+
+// Name is the name of the JSON codec, and the content subtype of calls
+// encoded with it.
+const Name = "json"
+
+// DialOption returns a dial option that encodes all calls on a connection
+// with the JSON codec.
+func DialOption() grpc.DialOption {
+	return grpc.WithDefaultCallOptions(grpc.CallContentSubtype(Name))
 }
 
 // jsonMarshaler implements the jsonpb methods.
 type jsonMarshaler struct {
 	jsonpb.Marshaler
 	jsonpb.Unmarshaler
+	collections Collections
+	fieldName   func(name string) string
+	name        string
 }
 
 // Name returns the codec name.
-func (jsonMarshaler) Name() string {
-	return "json"
+func (j jsonMarshaler) Name() string {
+	return j.name
 }
 
 // Marshal marshals JSON.
 func (j jsonMarshaler) Marshal(v interface{}) (out []byte, err error) {
 	if pm, ok := v.(proto.Message); ok {
+		t, marshaler := j.transform()
 		b := new(bytes.Buffer)
-		err := j.Marshaler.Marshal(b, pm)
+		err := marshaler.Marshal(b, pm)
 		if err != nil {
 			return nil, err
 		}
+		if nil == t {
+			return b.Bytes(), nil
+		}
+		out, err := t.message(b.Bytes(), reflect.ValueOf(pm))
+		if nil != err || "" == j.Marshaler.Indent {
+			return out, err
+		}
+		b.Reset()
+		if err := json.Indent(b, out, "", j.Marshaler.Indent); nil != err {
+			return nil, err
+		}
 		return b.Bytes(), nil
 	}
 	return json.Marshal(v)
 }
 
-// Unmarshal unmarshals JSON.
+// transform returns the post-marshal pass required by the codec options, if
+// any, and the jsonpb marshaler to run before it. The pass always runs on
+// compact JSON and relies on EmitDefaults to find every field.
+func (j jsonMarshaler) transform() (*transform, jsonpb.Marshaler) {
+	marshaler := j.Marshaler
+	t := &transform{rename: j.fieldName}
+	switch {
+	case CollectionsOmit == j.collections && marshaler.EmitDefaults:
+		t.omit = func(f field) bool {
+			return f.collection && f.empty
+		}
+	case CollectionsEmit == j.collections && !marshaler.EmitDefaults:
+		marshaler.EmitDefaults = true
+		t.omit = func(f field) bool {
+			return !f.collection && f.empty
+		}
+	}
+	if nil == t.omit && nil == t.rename {
+		return nil, marshaler
+	}
+	marshaler.Indent = ""
+	return t, marshaler
+}
+
+// Unmarshal unmarshals JSON. Input that is not valid UTF-8 is rejected with
+// an InvalidArgument error identifying the offending byte offset.
 func (j jsonMarshaler) Unmarshal(data []byte, v interface{}) (err error) {
+	if offset := invalidUTF8(data); offset >= 0 {
+		return status.Errorf(codes.InvalidArgument, "json: invalid UTF-8 encoding at byte offset %d", offset)
+	}
 	if pm, ok := v.(proto.Message); ok {
+		if nil != j.fieldName {
+			if data, err = (transform{rename: j.fieldName}).inverse(data, reflect.TypeOf(pm)); nil != err {
+				return err
+			}
+		}
 		b := bytes.NewBuffer(data)
 		return j.Unmarshaler.Unmarshal(b, pm)
 	}
 	return json.Unmarshal(data, v)
 }
+
+// invalidUTF8 returns the byte offset of the first invalid UTF-8 sequence in
+// data, or -1 if data is valid UTF-8.
+func invalidUTF8(data []byte) int {
+	if utf8.Valid(data) {
+		return -1
+	}
+	for offset := 0; offset < len(data); {
+		r, size := utf8.DecodeRune(data[offset:])
+		if utf8.RuneError == r && 1 == size {
+			return offset
+		}
+		offset += size
+	}
+	return -1
+}
@@ -0,0 +1,69 @@
+package jsonpb
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/encoding"
+)
+
+// unknownField is a google.rpc.Status with a field it doesn't define.
+const unknownField = `{"code":3,"message":"a","extra":{"added":"later"}}`
+
+func TestUnknownFieldsIgnoredByDefault(t *testing.T) {
+	defer Register(defaultOpts)
+
+	Register(jsonpb.Marshaler{})
+	codecs := map[string]encoding.Codec{
+		"Register":           encoding.GetCodec(Name),
+		"NewCodec(Config{})": NewCodec(Config{}),
+	}
+	RegisterConfig(Config{})
+	codecs["RegisterConfig(Config{})"] = encoding.GetCodec(Name)
+
+	for name, codec := range codecs {
+		msg := &spb.Status{}
+		if err := codec.Unmarshal([]byte(unknownField), msg); nil != err {
+			t.Errorf("%s: unknown field not ignored: %v", name, err)
+			continue
+		}
+		if 3 != msg.Code || "a" != msg.Message {
+			t.Errorf("%s: decoded %v", name, msg)
+		}
+	}
+}
+
+func TestAllowUnknownFields(t *testing.T) {
+	for _, test := range []struct {
+		allow   bool
+		wantErr bool
+	}{
+		{allow: true, wantErr: false},
+		{allow: false, wantErr: true},
+	} {
+		codec := NewCodec(Config{Unmarshaler: &jsonpb.Unmarshaler{AllowUnknownFields: test.allow}})
+		err := codec.Unmarshal([]byte(unknownField), &spb.Status{})
+		if test.wantErr != (nil != err) {
+			t.Errorf("AllowUnknownFields %v: got error %v, want error %v", test.allow, err, test.wantErr)
+		}
+	}
+}
+
+func TestNamedCodecs(t *testing.T) {
+	defer Register(defaultOpts)
+
+	RegisterConfig(Config{Name: "json-strict", Unmarshaler: &jsonpb.Unmarshaler{}})
+	strict := encoding.GetCodec("json-strict")
+	if nil == strict || "json-strict" != strict.Name() {
+		t.Fatalf("json-strict codec not registered: %v", strict)
+	}
+	if err := strict.Unmarshal([]byte(unknownField), &spb.Status{}); nil == err {
+		t.Error("json-strict codec accepted an unknown field")
+	}
+
+	// the default codec is unaffected.
+	if err := encoding.GetCodec(Name).Unmarshal([]byte(unknownField), &spb.Status{}); nil != err {
+		t.Errorf("json codec rejected an unknown field: %v", err)
+	}
+}
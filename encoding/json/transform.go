@@ -0,0 +1,345 @@
+package jsonpb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// field describes a message field rendered in a JSON object.
+type field struct {
+	name       string // proto field name
+	value      reflect.Value
+	collection bool // repeated or map field
+	empty      bool // unset, zero or empty value
+}
+
+// transform re-renders the JSON produced by jsonpb for a message, walking the
+// message alongside its JSON representation so that object keys can be
+// matched to the message fields they represent.
+type transform struct {
+	omit   func(f field) bool       // omit reports whether a field is dropped from the output
+	rename func(name string) string // rename returns the output key for a proto field name
+}
+
+// message re-renders the JSON object data representing the message v.
+// Well-known types and values that aren't generated messages are returned
+// unchanged.
+func (t transform) message(data []byte, v reflect.Value) ([]byte, error) {
+	for reflect.Ptr == v.Kind() || reflect.Interface == v.Kind() {
+		if v.IsNil() {
+			return data, nil
+		}
+		v = v.Elem()
+	}
+	if reflect.Struct != v.Kind() || isWellKnown(v.Type()) || "null" == string(bytes.TrimSpace(data)) {
+		return data, nil
+	}
+
+	fields := messageFields(v)
+	keys, values, err := decodeObject(data)
+	if nil != err {
+		return nil, err
+	}
+
+	outKeys := make([]string, 0, len(keys))
+	outValues := make([]json.RawMessage, 0, len(values))
+	for i, key := range keys {
+		value := values[i]
+		if f, ok := fields[key]; ok {
+			if nil != t.omit && t.omit(f) {
+				continue
+			}
+			if value, err = t.value(value, f.value); nil != err {
+				return nil, err
+			}
+			if nil != t.rename {
+				key = t.rename(f.name)
+			}
+		}
+		outKeys = append(outKeys, key)
+		outValues = append(outValues, value)
+	}
+	return encodeObject(outKeys, outValues), nil
+}
+
+// value re-renders the JSON value data of a field, recursing into nested
+// messages, repeated messages and maps of messages.
+func (t transform) value(data []byte, v reflect.Value) ([]byte, error) {
+	if "null" == string(bytes.TrimSpace(data)) {
+		return data, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return t.message(data, v)
+
+	case reflect.Slice:
+		if reflect.Uint8 == v.Type().Elem().Kind() {
+			return data, nil
+		}
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); nil != err {
+			return nil, err
+		}
+		if len(items) != v.Len() {
+			return data, nil
+		}
+		for i := range items {
+			item, err := t.value(items[i], v.Index(i))
+			if nil != err {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return json.Marshal(items)
+
+	case reflect.Map:
+		keys, values, err := decodeObject(data)
+		if nil != err {
+			return nil, err
+		}
+		entries := map[string]reflect.Value{}
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprint(key.Interface())] = v.MapIndex(key)
+		}
+		for i, key := range keys {
+			if entry, ok := entries[key]; ok {
+				if values[i], err = t.value(values[i], entry); nil != err {
+					return nil, err
+				}
+			}
+		}
+		return encodeObject(keys, values), nil
+	}
+
+	return data, nil
+}
+
+// inverse renames the keys of the JSON object data representing a message of
+// type typ from their renamed form back to the proto field names, recursing
+// into nested messages. Keys that don't match a renamed field are left as
+// they are.
+func (t transform) inverse(data []byte, typ reflect.Type) ([]byte, error) {
+	for reflect.Ptr == typ.Kind() {
+		typ = typ.Elem()
+	}
+	if reflect.Struct != typ.Kind() || isWellKnown(typ) || "null" == string(bytes.TrimSpace(data)) {
+		return data, nil
+	}
+
+	fields := messageFieldTypes(typ)
+	renamed := make(map[string]string, len(fields))
+	for name := range fields {
+		renamed[t.rename(name)] = name
+	}
+
+	keys, values, err := decodeObject(data)
+	if nil != err {
+		return nil, err
+	}
+	for i, key := range keys {
+		name, ok := renamed[key]
+		if !ok {
+			continue
+		}
+		keys[i] = name
+		if values[i], err = t.inverseValue(values[i], fields[name]); nil != err {
+			return nil, err
+		}
+	}
+	return encodeObject(keys, values), nil
+}
+
+// inverseValue renames the keys of messages in the JSON value data of a field
+// of type typ back to the proto field names.
+func (t transform) inverseValue(data []byte, typ reflect.Type) ([]byte, error) {
+	if "null" == string(bytes.TrimSpace(data)) {
+		return data, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return t.inverse(data, typ)
+
+	case reflect.Slice:
+		if reflect.Uint8 == typ.Elem().Kind() {
+			return data, nil
+		}
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); nil != err {
+			return nil, err
+		}
+		for i := range items {
+			item, err := t.inverseValue(items[i], typ.Elem())
+			if nil != err {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return json.Marshal(items)
+
+	case reflect.Map:
+		keys, values, err := decodeObject(data)
+		if nil != err {
+			return nil, err
+		}
+		for i := range values {
+			if values[i], err = t.inverseValue(values[i], typ.Elem()); nil != err {
+				return nil, err
+			}
+		}
+		return encodeObject(keys, values), nil
+	}
+
+	return data, nil
+}
+
+// messageFields maps the JSON keys a message's fields may be rendered as
+// (both the original proto name and the lowerCamelCase JSON name) to the
+// fields. Set oneof members are included under their own names.
+func messageFields(v reflect.Value) map[string]field {
+	fields := map[string]field{}
+	props := proto.GetProperties(v.Type())
+
+	add := func(prop *proto.Properties, value reflect.Value, empty bool) {
+		kind := value.Kind()
+		f := field{
+			name:       prop.OrigName,
+			value:      value,
+			collection: reflect.Map == kind || (reflect.Slice == kind && reflect.Uint8 != value.Type().Elem().Kind()),
+			empty:      empty,
+		}
+		fields[prop.OrigName] = f
+		if "" != prop.JSONName {
+			fields[prop.JSONName] = f
+		}
+	}
+
+	for i, prop := range props.Prop {
+		if strings.HasPrefix(prop.Name, "XXX_") || i >= v.NumField() {
+			continue
+		}
+		value := v.Field(i)
+		if "" == v.Type().Field(i).Tag.Get("protobuf_oneof") {
+			add(prop, value, isEmpty(value))
+			continue
+		}
+
+		// oneof: the field holds a *Wrapper{Member} for the set member, which
+		// is never empty, even if it holds a zero value.
+		if value.IsNil() {
+			continue
+		}
+		wrapper := value.Elem()
+		for _, oneof := range props.OneofTypes {
+			if oneof.Type == wrapper.Type() {
+				add(oneof.Prop, wrapper.Elem().Field(0), false)
+			}
+		}
+	}
+	return fields
+}
+
+// messageFieldTypes maps the proto field names of all fields of a message
+// type, including all oneof members, to their Go types.
+func messageFieldTypes(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	props := proto.GetProperties(typ)
+	for i, prop := range props.Prop {
+		if strings.HasPrefix(prop.Name, "XXX_") || i >= typ.NumField() {
+			continue
+		}
+		if "" == typ.Field(i).Tag.Get("protobuf_oneof") {
+			fields[prop.OrigName] = typ.Field(i).Type
+		}
+	}
+	for _, oneof := range props.OneofTypes {
+		fields[oneof.Prop.OrigName] = oneof.Type.Elem().Field(0).Type
+	}
+	return fields
+}
+
+// encodeObject encodes keys and raw values as a JSON object, in order.
+func encodeObject(keys []string, values []json.RawMessage) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(values[i])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// decodeObject decodes a JSON object into its keys and raw values, preserving
+// their order.
+func decodeObject(data []byte) ([]string, []json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); nil != err {
+		return nil, nil, err
+	} else if delim, ok := token.(json.Delim); !ok || '{' != delim {
+		return nil, nil, fmt.Errorf("json: expected object, found %v", token)
+	}
+
+	keys := []string{}
+	values := []json.RawMessage{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if nil != err {
+			return nil, nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("json: expected object key, found %v", token)
+		}
+		value := json.RawMessage{}
+		if err := decoder.Decode(&value); nil != err {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
+
+// isEmpty reports whether a field value is unset: a nil message or oneof, an
+// empty collection or a scalar zero value.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String:
+		return 0 == v.Len()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 0 == v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 0 == v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return 0 == v.Float()
+	}
+	return false
+}
+
+// isWellKnown reports whether the struct type typ is a google.protobuf
+// well-known type, which jsonpb renders with a special JSON representation.
+// Types that aren't generated messages are reported as well-known too, so
+// that they are left alone.
+func isWellKnown(typ reflect.Type) bool {
+	pb, ok := reflect.New(typ).Interface().(proto.Message)
+	if !ok {
+		return true
+	}
+	return strings.HasPrefix(proto.MessageName(pb), "google.protobuf.")
+}
@@ -0,0 +1,169 @@
+package jsonpb
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/duration"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// upperCamel renames "overload_id" to "OverloadId".
+func upperCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		if "" != part {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// equalJSON reports whether two JSON documents hold the same values.
+func equalJSON(t *testing.T, got []byte, want string) bool {
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); nil != err {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); nil != err {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestTransform(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		conf Config
+		msg  proto.Message
+		want string
+	}{
+		{
+			name: "rename nested messages, maps and well-known types",
+			conf: Config{FieldName: upperCamel},
+			msg: &expr.CheckedExpr{
+				ReferenceMap: map[int64]*expr.Reference{
+					1: {Name: "f", OverloadId: []string{"a", "b"}, Value: &expr.Constant{
+						ConstantKind: &expr.Constant_DurationValue{DurationValue: &duration.Duration{Seconds: 1}},
+					}},
+					2: {Name: "g", Value: &expr.Constant{ConstantKind: &expr.Constant_StringValue{StringValue: "s"}}},
+				},
+				SourceInfo: &expr.SourceInfo{Location: "a.cel", LineOffsets: []int32{3, 7}, Positions: map[int64]int32{1: 0}},
+			},
+			want: `{
+				"ReferenceMap": {
+					"1": {"Name": "f", "OverloadId": ["a", "b"], "Value": {"DurationValue": "1s"}},
+					"2": {"Name": "g", "Value": {"StringValue": "s"}}
+				},
+				"SourceInfo": {"Location": "a.cel", "LineOffsets": [3, 7], "Positions": {"1": 0}}
+			}`,
+		},
+		{
+			name: "rename oneof message members and repeated messages",
+			conf: Config{FieldName: upperCamel},
+			msg: &expr.Decl{Name: "d", DeclKind: &expr.Decl_Function{Function: &expr.Decl_FunctionDecl{
+				Overloads: []*expr.Decl_FunctionDecl_Overload{
+					{OverloadId: "o1", TypeParams: []string{"T"}},
+					{OverloadId: "o2", IsInstanceFunction: true},
+				},
+			}}},
+			want: `{"Name": "d", "Function": {"Overloads": [
+				{"OverloadId": "o1", "TypeParams": ["T"]},
+				{"OverloadId": "o2", "IsInstanceFunction": true}
+			]}}`,
+		},
+		{
+			name: "well-known type contents are not renamed",
+			conf: Config{FieldName: upperCamel},
+			msg: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"a_b": {Kind: &structpb.Value_StringValue{StringValue: "c"}},
+			}},
+			want: `{"a_b": "c"}`,
+		},
+		{
+			name: "omit empty collections",
+			conf: Config{EmptyCollections: CollectionsOmit, Marshaler: jsonpb.Marshaler{EmitDefaults: true, OrigName: true}},
+			msg:  &expr.Reference{Name: "f"},
+			want: `{"name": "f", "value": null}`,
+		},
+		{
+			name: "omit empty collections of nested messages",
+			conf: Config{EmptyCollections: CollectionsOmit, Marshaler: jsonpb.Marshaler{EmitDefaults: true, OrigName: true}},
+			msg: &expr.Reference{Name: "f", OverloadId: []string{"a"}, Value: &expr.Constant{
+				ConstantKind: &expr.Constant_StringValue{StringValue: ""},
+			}},
+			want: `{"name": "f", "overload_id": ["a"], "value": {"string_value": ""}}`,
+		},
+		{
+			name: "emit empty collections",
+			conf: Config{EmptyCollections: CollectionsEmit},
+			msg:  &expr.Reference{Name: "f"},
+			want: `{"name": "f", "overloadId": []}`,
+		},
+		{
+			name: "emit empty collections of map values",
+			conf: Config{EmptyCollections: CollectionsEmit},
+			msg:  &expr.CheckedExpr{ReferenceMap: map[int64]*expr.Reference{1: {}}},
+			want: `{"referenceMap": {"1": {"overloadId": []}}, "typeMap": {}}`,
+		},
+		{
+			name: "emit set oneof members",
+			conf: Config{EmptyCollections: CollectionsEmit},
+			msg:  &expr.Constant{ConstantKind: &expr.Constant_StringValue{StringValue: ""}},
+			want: `{"stringValue": ""}`,
+		},
+	} {
+		codec := NewCodec(test.conf)
+		got, err := codec.Marshal(test.msg)
+		if nil != err {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !equalJSON(t, got, test.want) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+			continue
+		}
+
+		// the output unmarshals back into the same message.
+		decoded := proto.Clone(test.msg)
+		decoded.Reset()
+		if err := codec.Unmarshal(got, decoded); nil != err {
+			t.Errorf("%s: unmarshal: %v", test.name, err)
+			continue
+		}
+		if !proto.Equal(test.msg, decoded) {
+			t.Errorf("%s: round trip got %v, want %v", test.name, decoded, test.msg)
+		}
+	}
+}
+
+func TestTransformIndent(t *testing.T) {
+	codec := NewCodec(Config{FieldName: upperCamel, Marshaler: jsonpb.Marshaler{Indent: "  "}})
+	got, err := codec.Marshal(&expr.Reference{Name: "f"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"Name\": \"f\"\n}"; want != string(got) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInverseKeepsUnknownKeys(t *testing.T) {
+	codec := NewCodec(Config{FieldName: upperCamel})
+	msg := &expr.Reference{}
+	// proto and JSON names are still accepted.
+	if err := codec.Unmarshal([]byte(`{"Name":"f","overload_id":["a"],"value":{"stringValue":"s"}}`), msg); nil != err {
+		t.Fatal(err)
+	}
+	want := &expr.Reference{Name: "f", OverloadId: []string{"a"}, Value: &expr.Constant{
+		ConstantKind: &expr.Constant_StringValue{StringValue: "s"},
+	}}
+	if !proto.Equal(want, msg) {
+		t.Errorf("got %v, want %v", msg, want)
+	}
+}
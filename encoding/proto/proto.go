@@ -0,0 +1,38 @@
+// Package proto registers the standard binary protobuf gRPC codec and
+// provides the dial option to select it.
+//
+// gRPC selects the codec of a call by the content subtype of its
+// content-type: "application/grpc" and "application/grpc+proto" use the
+// codec named "proto", and "application/grpc+json" the codec named "json"
+// registered by the encoding/json package. Registering the JSON codec
+// doesn't replace the binary codec, and servers accept both; clients choose
+// the codec of their calls, binary protobuf unless configured otherwise.
+package proto
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	grpc_proto "google.golang.org/grpc/encoding/proto"
+)
+
+// Name is the name of the binary protobuf codec, and the content subtype of
+// calls encoded with it.
+const Name = grpc_proto.Name
+
+// Register registers the standard binary protobuf codec, restoring it if a
+// codec registered under the same name replaced it. This is not thread-safe
+// outside of init() routines.
+func Register() {
+	encoding.RegisterCodec(codec)
+}
+
+// codec is the standard binary protobuf codec, registered by the
+// grpc/encoding/proto package.
+var codec = encoding.GetCodec(Name)
+
+// DialOption returns a dial option that encodes all calls on a connection
+// with binary protobuf, e.g. to override a JSON default set with
+// json.DialOption.
+func DialOption() grpc.DialOption {
+	return grpc.WithDefaultCallOptions(grpc.CallContentSubtype(Name))
+}
@@ -0,0 +1,95 @@
+// Package sse defines a grpc-gateway marshaler that renders server-streaming
+// responses as server-sent events.
+//
+// A response stream is rendered as a sequence of "result" events, one per
+// message, each carrying the JSON encoded message as its data:
+//
+//	event: result
+//	data: {"name":"a"}
+//
+// If the stream fails, including after some messages were sent and the
+// response status has already been written as 200, the stream ends with a
+// single "error" event carrying the gRPC status:
+//
+//	event: error
+//	data: {"grpcCode":14,"httpCode":503,"message":"unavailable","httpStatus":"Service Unavailable"}
+//
+// A stream that ends without an "error" event completed successfully.
+//
+// The default grpc-gateway chunked JSON encoding follows the same convention:
+// every message is a {"result": ...} object followed by a newline, and a
+// failed stream ends with an {"error": ...} object carrying the same status
+// fields.
+package sse
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+// EventStream is a Marshaler which renders streaming responses as
+// server-sent events (text/event-stream), using runtime.JSONPb to encode the
+// event data. Other values, such as unary responses and error bodies, are
+// rendered as plain JSON.
+//
+// It can be registered for clients that request an event stream with:
+// `runtime.WithMarshalerOption("text/event-stream", &sse.EventStream{}),`
+type EventStream struct {
+	runtime.JSONPb
+}
+
+// Confirm *EventStream is a runtime.Marshaler
+var _ runtime.Marshaler = &EventStream{}
+
+// ContentType returns the server-sent events content type.
+func (*EventStream) ContentType() string {
+	return "text/event-stream"
+}
+
+// Delimiter returns the blank line that terminates an event.
+func (*EventStream) Delimiter() []byte {
+	return []byte("\n\n")
+}
+
+// Marshal marshals stream chunks into events and anything else into JSON.
+// The grpc-gateway passes stream chunks as map[string]proto.Message, newer
+// versions pass result chunks as map[string]interface{}.
+func (e *EventStream) Marshal(v interface{}) ([]byte, error) {
+	switch chunk := v.(type) {
+	case map[string]interface{}:
+		if result, ok := chunk["result"]; ok && 1 == len(chunk) {
+			return e.event("result", result)
+		}
+	case map[string]proto.Message:
+		if result, ok := chunk["result"]; ok && 1 == len(chunk) {
+			return e.event("result", result)
+		}
+		if err, ok := chunk["error"]; ok && 1 == len(chunk) {
+			// the gateway doesn't write a delimiter after the error chunk.
+			event, merr := e.event("error", err)
+			if nil != merr {
+				return nil, merr
+			}
+			return append(event, e.Delimiter()...), nil
+		}
+	}
+	return e.JSONPb.Marshal(v)
+}
+
+// event renders a single event, splitting multi-line (indented) data into
+// multiple data fields.
+func (e *EventStream) event(name string, v interface{}) ([]byte, error) {
+	data, err := e.JSONPb.Marshal(v)
+	if nil != err {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("event: " + name)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("\ndata: ")
+		buf.Write(line)
+	}
+	return buf.Bytes(), nil
+}
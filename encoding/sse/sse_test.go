@@ -0,0 +1,131 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// forward streams messages followed by err, io.EOF if nil, through the
+// gateway with the EventStream marshaler.
+func forward(messages []string, err error) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx := runtime.NewServerMetadataContext(context.Background(), runtime.ServerMetadata{})
+	req := httptest.NewRequest("GET", "/stream", nil)
+	sent := 0
+	recv := func() (proto.Message, error) {
+		if sent < len(messages) {
+			sent++
+			return &spb.Status{Message: messages[sent-1]}, nil
+		}
+		if nil != err {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	runtime.ForwardResponseStream(ctx, runtime.NewServeMux(), &EventStream{}, recorder, req, recv)
+	return recorder
+}
+
+// events splits an event stream into its events.
+func events(t *testing.T, body string) []string {
+	if !strings.HasSuffix(body, "\n\n") {
+		t.Fatalf("event stream %q doesn't end with a blank line", body)
+	}
+	return strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n")
+}
+
+func TestEventStream(t *testing.T) {
+	recorder := forward([]string{"a", "b"}, nil)
+	if http.StatusOK != recorder.Code {
+		t.Errorf("status %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if ct := recorder.Header().Get("Content-Type"); "text/event-stream" != ct {
+		t.Errorf("content type %q, want text/event-stream", ct)
+	}
+	got := events(t, recorder.Body.String())
+	want := []string{
+		"event: result\ndata: {\"message\":\"a\"}",
+		"event: result\ndata: {\"message\":\"b\"}",
+	}
+	if len(want) != len(got) {
+		t.Fatalf("events %q, want %q", got, want)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("event %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEventStreamErrorAfterMessages(t *testing.T) {
+	for _, sent := range []int{0, 1, 3} {
+		messages := make([]string, sent)
+		for i := range messages {
+			messages[i] = "ok"
+		}
+		recorder := forward(messages, status.Error(codes.Unavailable, "backend down"))
+
+		// the status can only be set if nothing was written yet.
+		wantCode := http.StatusOK
+		if 0 == sent {
+			wantCode = http.StatusServiceUnavailable
+		}
+		if wantCode != recorder.Code {
+			t.Errorf("%d messages: status %d, want %d", sent, recorder.Code, wantCode)
+		}
+
+		got := events(t, recorder.Body.String())
+		if sent+1 != len(got) {
+			t.Fatalf("%d messages: events %q, want %d results and an error", sent, got, sent)
+		}
+		for _, event := range got[:sent] {
+			if "event: result\ndata: {\"message\":\"ok\"}" != event {
+				t.Errorf("%d messages: unexpected result event %q", sent, event)
+			}
+		}
+		last := got[sent]
+		if !strings.HasPrefix(last, "event: error\ndata: ") {
+			t.Fatalf("%d messages: last event %q isn't an error", sent, last)
+		}
+		data := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(last, "event: error\ndata: ")), &data); nil != err {
+			t.Fatalf("%d messages: invalid error data: %v", sent, err)
+		}
+		if "backend down" != data["message"] {
+			t.Errorf("%d messages: error message %v, want %q", sent, data["message"], "backend down")
+		}
+	}
+}
+
+func TestEventStreamIndentedData(t *testing.T) {
+	e := &EventStream{JSONPb: runtime.JSONPb{Indent: "  "}}
+	got, err := e.Marshal(map[string]proto.Message{"result": &spb.Status{Message: "a"}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := "event: result\ndata: {\ndata:   \"message\": \"a\"\ndata: }"
+	if want != string(got) {
+		t.Errorf("event %q, want %q", got, want)
+	}
+}
+
+func TestMarshalNonChunk(t *testing.T) {
+	got, err := (&EventStream{}).Marshal(&spb.Status{Message: "a"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if `{"message":"a"}` != string(got) {
+		t.Errorf("got %s, want plain JSON", got)
+	}
+}
@@ -0,0 +1,433 @@
+// Package xmlpb defines a grpc-gateway marshaler encoding protobuf messages
+// as XML, for clients that can't use JSON.
+//
+// Messages are converted through their JSON representation: a message is
+// marshaled by jsonpb and each JSON object key becomes an element, in field
+// order. The root element is named after the message type, e.g.
+// <ProbeResult>, or <response> for values that aren't messages. Repeated
+// fields are rendered as repeated elements of the same name, map fields as
+// an element holding one element per entry, named after the map key, and
+// null values are omitted. Map keys that aren't valid XML names are
+// rendered as <entry key="..."> elements instead:
+//
+//	<?xml version="1.0" encoding="UTF-8"?>
+//	<Item><name>a</name><tags>x</tags><tags>y</tags><labels><env>prod</env><entry key="1a">b</entry></labels></Item>
+//
+// Decoding reverses the mapping, using the message fields to tell repeated
+// fields from singular ones and to type the element text. Other attributes
+// are ignored. Limitations:
+//   - empty repeated fields can't be told apart from unset fields
+//   - well-known types are rendered and parsed as their JSON string forms,
+//     google.protobuf.Struct, Value, ListValue and Any are not supported
+package xmlpb
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+// XML is a Marshaler which marshals from and into XML (application/xml),
+// bridging through "github.com/golang/protobuf/jsonpb". Element names follow
+// the JSON field names, the original proto field names if OrigName is set.
+//
+// The grpc-gateway only selects it for requests whose Content-Type is exactly
+// a registered type, while clients usually add a charset, e.g.
+// "text/xml; charset=utf-8", so the gateway handler must be wrapped by the
+// middleware.MediaType middleware, which NewRouter includes. The charset of
+// the Content-Type header then takes precedence over the encoding of the XML
+// declaration. UTF-8, ASCII and Latin-1 documents are supported.
+//
+// It can be added before the MIMEWildcard with:
+// `runtime.WithMarshalerOption("application/xml", &xmlpb.XML{}),`
+// `runtime.WithMarshalerOption("text/xml", &xmlpb.XML{}),`
+type XML struct {
+	runtime.JSONPb
+}
+
+// Confirm *XML is a runtime.Marshaler
+var _ runtime.Marshaler = &XML{}
+
+// ContentType returns the Content-Type of marshalled data.
+func (x *XML) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+// Marshal marshals "v" into XML.
+func (x *XML) Marshal(v interface{}) ([]byte, error) {
+	data, err := x.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	root := "response"
+	if pm, ok := v.(proto.Message); ok {
+		if name := proto.MessageName(pm); "" != name {
+			root = name[strings.LastIndex(name, ".")+1:]
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := writeElement(buf, decoder, root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewEncoder returns an Encoder which writes XML into "w".
+func (x *XML) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v interface{}) error {
+		data, err := x.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// Unmarshal unmarshals XML "data" into "v".
+func (x *XML) Unmarshal(data []byte, v interface{}) error {
+	return x.decode(bytes.NewReader(data), v)
+}
+
+// NewDecoder returns a Decoder which reads XML data from "r".
+func (x *XML) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		return x.decode(r, v)
+	})
+}
+
+// mediaTypeParams is implemented by request bodies carrying the parameters of
+// the request media type, see middleware.MediaType.
+type mediaTypeParams interface {
+	MediaTypeParam(name string) string
+}
+
+// decode parses the XML document read from "r", converts it into the JSON
+// representation of "v" and unmarshals that with jsonpb. This method fails
+// if "v" is not a proto.Message.
+func (x *XML) decode(r io.Reader, v interface{}) error {
+	if _, ok := v.(proto.Message); !ok {
+		return fmt.Errorf("not proto message")
+	}
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charsetReader
+	if body, ok := r.(mediaTypeParams); ok {
+		if charset := body.MediaTypeParam("charset"); "" != charset {
+			reader, err := charsetReader(charset, r)
+			if err != nil {
+				return err
+			}
+			// the document is UTF-8 now, whatever its declaration says.
+			decoder = xml.NewDecoder(reader)
+			decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+				return input, nil
+			}
+		}
+	}
+	root, err := readElement(decoder)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(convert(root, reflect.TypeOf(v)))
+	if err != nil {
+		return err
+	}
+	return x.JSONPb.Unmarshal(data, v)
+}
+
+// writeElement writes the next JSON value read from decoder as an element
+// named name. Arrays are written as repeated elements and null values are
+// omitted.
+func writeElement(w *bytes.Buffer, decoder *json.Decoder, name string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if '[' == token {
+			for decoder.More() {
+				if err := writeElement(w, decoder, name); err != nil {
+					return err
+				}
+			}
+			_, err := decoder.Token()
+			return err
+		}
+		writeStart(w, name)
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if err := writeElement(w, decoder, key.(string)); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		writeEnd(w, name)
+	case nil:
+	default:
+		writeStart(w, name)
+		xml.EscapeText(w, []byte(fmt.Sprint(token)))
+		writeEnd(w, name)
+	}
+	return nil
+}
+
+// entryElement is the name of the elements holding values whose keys aren't
+// valid XML names, which are set as the entryKey attribute instead.
+const (
+	entryElement = "entry"
+	entryKey     = "key"
+)
+
+// writeStart writes the start tag of an element named name.
+func writeStart(w *bytes.Buffer, name string) {
+	if validName(name) {
+		w.WriteString("<" + name + ">")
+		return
+	}
+	w.WriteString("<" + entryElement + " " + entryKey + `="`)
+	xml.EscapeText(w, []byte(name))
+	w.WriteString(`">`)
+}
+
+// writeEnd writes the end tag of an element named name.
+func writeEnd(w *bytes.Buffer, name string) {
+	if !validName(name) {
+		name = entryElement
+	}
+	w.WriteString("</" + name + ">")
+}
+
+// validName reports whether name is a valid XML element name without a
+// namespace prefix, the NCName production of the Namespaces in XML
+// recommendation.
+func validName(name string) bool {
+	if "" == name {
+		return false
+	}
+	for i, r := range name {
+		if !isNameStartChar(r) && (0 == i || !isNameChar(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNameStartChar reports whether r can start an XML name, excluding ':'.
+func isNameStartChar(r rune) bool {
+	return 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || '_' == r ||
+		0xC0 <= r && r <= 0xD6 || 0xD8 <= r && r <= 0xF6 || 0xF8 <= r && r <= 0x2FF ||
+		0x370 <= r && r <= 0x37D || 0x37F <= r && r <= 0x1FFF || 0x200C <= r && r <= 0x200D ||
+		0x2070 <= r && r <= 0x218F || 0x2C00 <= r && r <= 0x2FEF || 0x3001 <= r && r <= 0xD7FF ||
+		0xF900 <= r && r <= 0xFDCF || 0xFDF0 <= r && r <= 0xFFFD || 0x10000 <= r && r <= 0xEFFFF
+}
+
+// isNameChar reports whether r can follow the first character of an XML
+// name, excluding ':'.
+func isNameChar(r rune) bool {
+	return isNameStartChar(r) || '-' == r || '.' == r || '0' <= r && r <= '9' ||
+		0xB7 == r || 0x300 <= r && r <= 0x36F || 0x203F <= r && r <= 0x2040
+}
+
+// element is a parsed XML element.
+type element struct {
+	name     string
+	text     string
+	children []*element
+}
+
+// readElement reads the next element, and all its children, from decoder.
+func readElement(decoder *xml.Decoder) (*element, error) {
+	var stack []*element
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if io.EOF == err {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			e := &element{name: token.Name.Local}
+			if entryElement == e.name {
+				for _, attr := range token.Attr {
+					if entryKey == attr.Name.Local {
+						e.name = attr.Value
+					}
+				}
+			}
+			if 0 < len(stack) {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			}
+			stack = append(stack, e)
+		case xml.CharData:
+			if 0 < len(stack) {
+				stack[len(stack)-1].text += string(token)
+			}
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if 0 == len(stack) {
+				return e, nil
+			}
+		}
+	}
+}
+
+// convert returns the JSON representation of an element as a value of
+// type typ.
+func convert(e *element, typ reflect.Type) interface{} {
+	for reflect.Ptr == typ.Kind() && reflect.Struct != typ.Elem().Kind() {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		if wellKnown(typ) {
+			// wrappers hold a single value field, other types use their
+			// JSON string forms.
+			if field, ok := typ.Elem().FieldByName("Value"); ok {
+				return convert(e, field.Type)
+			}
+			return strings.TrimSpace(e.text)
+		}
+		fields := messageFields(typ.Elem())
+		object := map[string]interface{}{}
+		for _, child := range e.children {
+			fieldType, ok := fields[child.name]
+			if !ok {
+				object[child.name] = strings.TrimSpace(child.text)
+				continue
+			}
+			switch {
+			case reflect.Slice == fieldType.Kind() && reflect.Uint8 != fieldType.Elem().Kind():
+				items, _ := object[child.name].([]interface{})
+				object[child.name] = append(items, convert(child, fieldType.Elem()))
+			case reflect.Map == fieldType.Kind():
+				entries := map[string]interface{}{}
+				for _, entry := range child.children {
+					entries[entry.name] = convert(entry, fieldType.Elem())
+				}
+				object[child.name] = entries
+			default:
+				object[child.name] = convert(child, fieldType)
+			}
+		}
+		return object
+
+	case reflect.Bool:
+		return "true" == strings.TrimSpace(e.text)
+
+	case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		text := strings.TrimSpace(e.text)
+		if _, ok := reflect.Zero(typ).Interface().(fmt.Stringer); ok && !isNumber(text) {
+			return text // enum value name
+		}
+		return json.Number(text)
+	}
+	return e.text
+}
+
+// messageFields maps the JSON names and the original names of the fields of
+// a generated message struct, including all oneof members, to their types.
+func messageFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	props := proto.GetProperties(typ)
+	add := func(prop *proto.Properties, fieldType reflect.Type) {
+		fields[prop.OrigName] = fieldType
+		if "" != prop.JSONName {
+			fields[prop.JSONName] = fieldType
+		}
+	}
+	for i, prop := range props.Prop {
+		if strings.HasPrefix(prop.Name, "XXX_") || i >= typ.NumField() {
+			continue
+		}
+		if "" == typ.Field(i).Tag.Get("protobuf_oneof") {
+			add(prop, typ.Field(i).Type)
+		}
+	}
+	for _, oneof := range props.OneofTypes {
+		add(oneof.Prop, oneof.Type.Elem().Field(0).Type)
+	}
+	return fields
+}
+
+// wellKnown reports whether the message pointer type typ is a
+// google.protobuf well-known type with a special JSON representation. Types
+// that aren't generated messages are reported as well-known too.
+func wellKnown(typ reflect.Type) bool {
+	pb, ok := reflect.New(typ.Elem()).Interface().(proto.Message)
+	if !ok {
+		return true
+	}
+	return wellKnownTypes[proto.MessageName(pb)]
+}
+
+// wellKnownTypes are the well-known types jsonpb renders as JSON values
+// other than objects.
+var wellKnownTypes = map[string]bool{
+	"google.protobuf.Any":         true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.BytesValue":  true,
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.Duration":    true,
+	"google.protobuf.FieldMask":   true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.ListValue":   true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.Struct":      true,
+	"google.protobuf.Timestamp":   true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Value":       true,
+}
+
+// isNumber reports whether text is a number.
+func isNumber(text string) bool {
+	_, err := strconv.ParseFloat(text, 64)
+	return nil == err
+}
+
+// charsetReader converts Latin-1 and ASCII documents to UTF-8. Documents in
+// other encodings are rejected.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	}
+	return nil, fmt.Errorf("unsupported XML encoding %q", charset)
+}
@@ -0,0 +1,67 @@
+package xmlpb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestMarshalInvalidNames(t *testing.T) {
+	got, err := (&XML{}).Marshal(map[string]string{
+		"a><script": "x",
+		"env":       "prod",
+		"1a":        "y",
+		`"q"`:       "z",
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	want := xml.Header + `<response>` +
+		`<entry key="&#34;q&#34;">z</entry>` +
+		`<entry key="1a">y</entry>` +
+		`<entry key="a&gt;&lt;script">x</entry>` +
+		`<env>prod</env>` +
+		`</response>`
+	if want != string(got) {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// the keys are restored when decoding.
+	root, err := readElement(xml.NewDecoder(bytes.NewReader(got)))
+	if nil != err {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, child := range root.children {
+		names = append(names, child.name)
+	}
+	wantNames := []string{`"q"`, "1a", "a><script", "env"}
+	if len(wantNames) != len(names) {
+		t.Fatalf("decoded names %q, want %q", names, wantNames)
+	}
+	for i := range wantNames {
+		if wantNames[i] != names[i] {
+			t.Errorf("decoded name %q, want %q", names[i], wantNames[i])
+		}
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"env":       true,
+		"_x":        true,
+		"a-b.c1":    true,
+		"été":       true,
+		"":          false,
+		"1a":        false,
+		"-a":        false,
+		"a b":       false,
+		"a:b":       false,
+		"a><script": false,
+		"a/":        false,
+	} {
+		if got := validName(name); want != got {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -2,26 +2,32 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
-	"syscall"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
 
 	"github.com/bdlm/log"
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
-	"github.com/rs/cors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
-	httppb "github.com/bdlm/grpc-gateway-wrapper/encoding/http"
+	"github.com/bdlm/grpc-gateway-wrapper/docs"
+	xmlpb "github.com/bdlm/grpc-gateway-wrapper/encoding/xml"
+	"github.com/bdlm/grpc-gateway-wrapper/example/proto/embedded_docs"
+	pb "github.com/bdlm/grpc-gateway-wrapper/example/proto/go/v1"
+	"github.com/bdlm/grpc-gateway-wrapper/gateway"
 	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+	"github.com/bdlm/grpc-gateway-wrapper/interceptor/metrics"
+	"github.com/bdlm/grpc-gateway-wrapper/interceptor/timeout"
+	gateway_middleware "github.com/bdlm/grpc-gateway-wrapper/middleware"
 	"github.com/bdlm/grpc-gateway-wrapper/server"
-	pb "github.com/bdlm/grpc-gateway-wrapper/example/proto/go/v1"
 
-	// register a protobuf JSON marshaller as the default gRPC encoder.
+	// register a protobuf JSON marshaller as the "json" gRPC codec.
 	_ "github.com/bdlm/grpc-gateway-wrapper/encoding/json"
 )
 
@@ -45,6 +51,7 @@ type serverEnv struct {
 	GrpcAddress string `default:"server:50051" split_words:"true"` // GRPC_ADDRESS
 	LogLevel    string `default:"info" split_words:"true"`         // LOG_LEVEL
 	ServerEnv   string `default:"prod" split_words:"true"`         // SERVER_ENV
+	TLSCaFile   string `default:"" split_words:"true"`             // TLS_CA_FILE, PEM CA certificates the gateway verifies the gRPC server with when TLS_CERT_FILE is set, the system roots if empty
 }
 
 // - parse configuration values out of environment variables.
@@ -64,8 +71,8 @@ func init() {
 	log.SetLevel(level)
 	log.WithField("level", Conf.LogLevel).Info("log level set")
 
-	// define the log format.
-	formatter := &log.TextFormatter{}
+	// define the log format, with the gateway fields in a stable order.
+	formatter := &log.TextFormatter{SortingFunc: log_interceptor.SortFields}
 	if "dev" == Conf.ServerEnv {
 		formatter.ForceTTY = true
 		log.Debug("TTY formatting enabled")
@@ -73,46 +80,31 @@ func init() {
 	log.SetFormatter(formatter)
 }
 
-// - create the application context and start a signal handler.
+// - create the application context.
 // - init the grpc-gateway multiplexer and add the protobuf-generated handlers.
 // - add the grpc-gateway router middleware.
 // - init the gRPC server and register it with the protobuf implementation.
 // - init the TCP connection handler.
 // - start the gRPC and HTTP servers.
-// - shutdown when complete.
+// - wait for a signal and shutdown.
 func main() {
-	// create the application context and start a signal handler.
+	// create the application context.
 	Ctx, Cancel = context.WithCancel(context.Background())
-	go func() {
-		interrupt := make(chan os.Signal, 1)
-		signal.Notify(
-			interrupt,
-			syscall.SIGINT,
-			syscall.SIGKILL,
-			syscall.SIGQUIT,
-			syscall.SIGSTOP,
-			syscall.SIGTERM,
-		)
-		sig := <-interrupt
-		log.WithField("signal", sig.String()).Info("signal received, shutting down")
-		Cancel()
-	}()
-
-	// init the grpc-gateway multiplexer.
-	Mux = runtime.NewServeMux(
-		// expect JSON data by default.
-		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
-			EmitDefaults: true, // don't omit properties with default values.
-			OrigName:     true, // encode JSON properties as defined in the protobuf (don't convert to CamelCase).
-		}),
-		// convert form data to JSON.
-		runtime.WithMarshalerOption("application/x-www-form-urlencoded", &httppb.Form{JSONPb: runtime.JSONPb{
-			EmitDefaults: true, // don't omit properties with default values.
-			OrigName:     true, // encode JSON properties as defined in the protobuf (don't convert to CamelCase).
-		}}),
-		// add all HTTP headers to the gRPC request context.
-		runtime.WithIncomingHeaderMatcher(func(headerName string) (string, bool) {
-			return headerName, true
+
+	// init the grpc-gateway multiplexer with the package defaults: JSON, form
+	// and multipart form data marshalers, a header matcher forwarding
+	// request headers except the hop-by-hop headers, and an error handler
+	// writing {"code": ..., "message": ..., "details": [...]}.
+	Mux = gateway.NewServeMux(
+		// accept and return XML for clients that request it. Content-Type
+		// parameters such as the charset are stripped by the router
+		// middleware before the marshaler is selected.
+		runtime.WithMarshalerOption("application/xml", &xmlpb.XML{JSONPb: runtime.JSONPb{OrigName: true}}),
+		runtime.WithMarshalerOption("text/xml", &xmlpb.XML{JSONPb: runtime.JSONPb{OrigName: true}}),
+		// set response headers per response type: probe results must never
+		// be served from a cache.
+		gateway.WithResponseOptions(map[string]gateway.ResponseOption{
+			"grpc.gateway.wrapper.ProbeResult": gateway.CacheControl("no-store"),
 		}),
 	)
 
@@ -121,23 +113,24 @@ func main() {
 		Ctx,
 		Mux,
 		Conf.GrpcAddress,
-		[]grpc.DialOption{grpc.WithInsecure()},
+		[]grpc.DialOption{
+			dialCredentials(),
+			// don't let a hung backend call hold a gateway request forever.
+			grpc.WithUnaryInterceptor((&timeout.Client{Default: time.Minute}).UnaryClientInterceptor),
+		},
 	)
 	if nil != err {
 		panic(errors.Wrap(err, "unable to register the grpc-gateway multiplexer with the gRPC server"))
 	}
 
-	// create a HTTP router that passes all requests to the grpc-gateway handlers.
-	Router = chi.NewRouter()
-	Router.Use(
-		cors.AllowAll().Handler, // CORS
-	)
-	Router.NotFound(Mux.ServeHTTP)
-	Router.MethodNotAllowed(Mux.ServeHTTP)
-	Router.With(
-		middleware.RedirectSlashes, // redirect requests with trailing path slash
-		middleware.DefaultCompress, // GZIP compression
-	)
+	// create a HTTP router with the recommended middleware stack that passes
+	// all requests to the grpc-gateway handlers. The CORS policy is
+	// configured by the CORS_* environment variables.
+	corsPolicy, err := gateway_middleware.NewCORS()
+	if nil != err {
+		panic(errors.Wrap(err, "invalid CORS configuration"))
+	}
+	Router = gateway_middleware.NewRouter(Mux, corsPolicy)
 
 	// logInterceptor is a middleware to log all HTTP requests and gRPC
 	// responses.
@@ -147,29 +140,76 @@ func main() {
 		LogUnaryReqMsg:   true,
 	}
 
+	// metricsInterceptor records Prometheus RPC metrics, exposed on
+	// /metrics.
+	metricsInterceptor := &metrics.Interceptor{}
+	Router.Handle("/metrics", metricsInterceptor.Handler())
+
+	// serve the embedded swagger docs, and a Swagger UI page at /docs/ui.
+	docsHandler := docs.Handler(embedded_docs.Docs, "/docs")
+	Router.Handle("/docs", docsHandler)
+	Router.Handle("/docs/*", docsHandler)
+
+	// baseContext cancels streams when the server shuts down, and in-flight
+	// requests if the shutdown times out.
+	baseContext := &server.BaseContext{}
+
 	// init the gRPC server and register it with the protobuf implementation.
-	grpcServer := grpc.NewServer(
+	grpcServer := server.NewGRPCServer(server.WithGRPCServerOptions(
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-			logInterceptor.StreamInterceptor, // automatically log requests
+			logInterceptor.StreamInterceptor,     // automatically log requests, before baseContext so shutdown isn't logged as a client cancel
+			baseContext.StreamInterceptor,        // cancel streams on shutdown
+			metricsInterceptor.StreamInterceptor, // record request metrics
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			logInterceptor.UnaryInterceptor, // automatically log requests
+			logInterceptor.UnaryInterceptor,     // automatically log requests, before baseContext so shutdown isn't logged as a client cancel
+			baseContext.UnaryInterceptor,        // cancel requests if shutdown times out
+			metricsInterceptor.UnaryInterceptor, // record request metrics
 		)),
-	)
+	))
 	pb.RegisterK8SServer(grpcServer, RPC{})
 
+	// log an inventory of the registered gRPC methods.
+	log_interceptor.LogServices(nil, grpcServer, nil)
+
 	// init the TCP connection manager.
-	tcpServer, err := server.New(Ctx, Router, grpcServer)
+	tcpServer, err := server.New(Ctx, Router, grpcServer, server.WithBaseContext(baseContext))
 	if nil != err {
 		panic(errors.Wrap(err, "could not initialize the TCP connection manager"))
 	}
 
+	// shutdown on SIGINT, SIGTERM or SIGQUIT.
+	done := tcpServer.HandleSignals()
+
 	// start the gRPC and HTTP servers.
 	log.Info("starting services")
-	tcpServer.ListenAndServe()
+	if err := tcpServer.Start(); nil != err {
+		panic(errors.Wrap(err, "could not start services"))
+	}
 
-	// shutdown when complete.
-	<-Ctx.Done()
-	tcpServer.Shutdown()
+	// wait for the shutdown to complete.
+	<-done
+	Cancel()
 	log.Info("shutdown complete")
 }
+
+// dialCredentials returns the transport credentials the gateway dials the
+// gRPC server with: TLS if the server serves TLS_CERT_FILE, plaintext
+// otherwise.
+func dialCredentials() grpc.DialOption {
+	if "" == server.Conf.TLSCertFile {
+		return grpc.WithInsecure()
+	}
+	config := &tls.Config{}
+	if "" != Conf.TLSCaFile {
+		pem, err := ioutil.ReadFile(Conf.TLSCaFile)
+		if nil != err {
+			panic(errors.Wrap(err, "could not read TLS_CA_FILE"))
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			panic(errors.New("no certificates found in TLS_CA_FILE"))
+		}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
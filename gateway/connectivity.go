@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"context"
+
+	"github.com/bdlm/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// LogConnectivity logs the connectivity state transitions of a client
+// connection (CONNECTING, READY, TRANSIENT_FAILURE, ...) with its target to
+// logger, or to the global logger if it is nil, until ctx is done or the
+// connection is closed, so backend connectivity flaps are visible in the logs
+// instead of only as intermittent Unavailable errors. It blocks, so run it in
+// its own goroutine.
+//
+// The generated Register*HandlerFromEndpoint functions don't expose their
+// connection; to log it, dial the backend and register the handlers with the
+// generated Register*Handler function instead:
+//
+//	conn, err := grpc.DialContext(ctx, address, opts...)
+//	...
+//	go gateway.LogConnectivity(ctx, logger, conn)
+//	err = pb.RegisterServiceHandler(ctx, mux, conn)
+func LogConnectivity(ctx context.Context, logger log_interceptor.Logger, conn *grpc.ClientConn) {
+	if nil == logger {
+		logger = log_interceptor.NewLogger(nil)
+	}
+	state := conn.GetState()
+	for {
+		logger.WithFields(log.Fields{
+			"state":  state.String(),
+			"target": conn.Target(),
+		}).Info("backend connectivity state changed")
+		if connectivity.Shutdown == state {
+			return
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+		state = conn.GetState()
+	}
+}
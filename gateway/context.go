@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ContextValue describes a request context value carried across the gateway
+// boundary. Values set on the HTTP request context by router middleware don't
+// reach the gRPC handler, which only receives the request metadata, so the
+// value is copied into the metadata by WithContextValues on the gateway side
+// and restored into the handler context by ContextValuesUnaryInterceptor or
+// ContextValuesStreamInterceptor on the gRPC side.
+//
+// The metadata is ordinary metadata that native gRPC clients can send as
+// well, so restored values must not be trusted for authorization unless the
+// metadata key is stripped from native requests.
+type ContextValue struct {
+	Key string                                                  // Key is the gRPC metadata key carrying the value, e.g. "x-ctx-tenant"
+	Get func(ctx context.Context) (string, bool)                // Get returns the value from the HTTP request context, if set
+	Set func(ctx context.Context, value string) context.Context // Set returns a gRPC handler context holding the value
+}
+
+// WithContextValues returns a ServeMuxOption that copies the values from the
+// HTTP request context into the outgoing gRPC request metadata.
+func WithContextValues(values ...ContextValue) runtime.ServeMuxOption {
+	return runtime.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+		md := metadata.MD{}
+		for _, value := range values {
+			if nil == value.Get {
+				continue
+			}
+			if v, ok := value.Get(r.Context()); ok {
+				md.Append(value.Key, v)
+			}
+		}
+		return md
+	})
+}
+
+// ContextValuesUnaryInterceptor returns a unary interceptor that restores the
+// values from the request metadata into the handler context.
+func ContextValuesUnaryInterceptor(values ...ContextValue) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		return handler(restoreContextValues(ctx, values), req)
+	}
+}
+
+// ContextValuesStreamInterceptor returns a stream interceptor that restores
+// the values from the request metadata into the stream context.
+func ContextValuesStreamInterceptor(values ...ContextValue) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = restoreContextValues(stream.Context(), values)
+		return handler(srv, wrapped)
+	}
+}
+
+// restoreContextValues returns a context holding the values found in the
+// incoming request metadata.
+func restoreContextValues(ctx context.Context, values []ContextValue) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	for _, value := range values {
+		if nil == value.Set {
+			continue
+		}
+		if v := md.Get(value.Key); len(v) > 0 {
+			ctx = value.Set(ctx, v[0])
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bdlm/log"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// WithErrorHandler returns a ServeMuxOption that writes errors as a
+// google.rpc.Status envelope, {"code": ..., "message": ..., "details": [...]},
+// encoded with the response marshaler. The HTTP status is mapped from the
+// gRPC code with runtime.HTTPStatusFromCode.
+//
+// Errors that aren't gRPC status errors are given a code with ClassifyError
+// rather than reported as Unknown. If the request has an ID, from the
+// x-request-id response metadata or the X-Request-Id request header, it is
+// added to the details as a google.rpc.RequestInfo and set as the
+// X-Request-Id response header, so clients can quote it when reporting
+// errors.
+func WithErrorHandler() runtime.ServeMuxOption {
+	return runtime.WithProtoErrorHandler(ErrorHandler)
+}
+
+// ErrorHandler is the runtime.ProtoErrorHandlerFunc installed by
+// WithErrorHandler.
+func ErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	s, ok := status.FromError(err)
+	if !ok {
+		code, _ := ClassifyError(err)
+		s = status.New(code, err.Error())
+	}
+
+	if id := errorRequestID(ctx, r); "" != id {
+		w.Header().Set("X-Request-Id", id)
+		withID, detailErr := s.WithDetails(&errdetails.RequestInfo{RequestId: id})
+		if nil != detailErr {
+			log.WithField("error-message", detailErr.Error()).Warn("could not add the request ID to the error details")
+		} else {
+			s = withID
+		}
+	}
+
+	runtime.DefaultHTTPProtoErrorHandler(ctx, mux, marshaler, w, r, s.Err())
+}
+
+// errorRequestID returns the ID of a failed request, from the response
+// metadata set by the gRPC server or the HTTP request header.
+func errorRequestID(ctx context.Context, r *http.Request) string {
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		if values := md.HeaderMD.Get(log_interceptor.RequestIDKey); 0 < len(values) && "" != values[0] {
+			return values[0]
+		}
+	}
+	return r.Header.Get(log_interceptor.RequestIDKey)
+}
@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+
+	"github.com/bdlm/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// ErrorClassifier contains gRPC client interceptor methods for the gateway's
+// connection to the gRPC server that convert errors that aren't gRPC status
+// errors, such as raw transport errors, into status errors with a specific
+// code, see ClassifyError. Each converted error is logged with its
+// classification.
+type ErrorClassifier struct {
+	Logger log_interceptor.Logger // Logger if set will be logged to instead of the global logger
+}
+
+// UnaryClientInterceptor is a grpc client interceptor that classifies the
+// errors of unary calls.
+func (ec *ErrorClassifier) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return ec.classify(method, invoker(ctx, method, req, reply, cc, opts...))
+}
+
+// StreamClientInterceptor is a grpc client interceptor that classifies the
+// errors establishing streams.
+func (ec *ErrorClassifier) StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	return stream, ec.classify(method, err)
+}
+
+// ClassifyErrorsUnaryClientInterceptor is a grpc client interceptor for the
+// gateway's connection to the gRPC server that converts errors that aren't
+// gRPC status errors, such as raw transport errors, into status errors with a
+// specific code, see ClassifyError. It logs to the global logger, see
+// ErrorClassifier.
+func ClassifyErrorsUnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return (&ErrorClassifier{}).UnaryClientInterceptor(ctx, method, req, reply, cc, invoker, opts...)
+}
+
+// ClassifyErrorsStreamClientInterceptor is a grpc client interceptor for the
+// gateway's connection to the gRPC server that converts errors establishing
+// a stream that aren't gRPC status errors into status errors with a specific
+// code, see ClassifyError. It logs to the global logger, see ErrorClassifier.
+func ClassifyErrorsStreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return (&ErrorClassifier{}).StreamClientInterceptor(ctx, desc, cc, method, streamer, opts...)
+}
+
+// ClassifyError returns the gRPC code and a short description for errors
+// that aren't gRPC status errors, which status.Code would report as Unknown:
+//   - connection refused and reset errors, EOF and DNS failures are
+//     Unavailable ("connection-refused", "connection-reset", "eof", "dns")
+//   - network timeouts and expired contexts are DeadlineExceeded ("timeout")
+//   - cancelled contexts are Canceled ("canceled")
+//
+// Other errors are Unknown ("unknown").
+func ClassifyError(err error) (codes.Code, string) {
+	err = rootCause(err)
+	switch err {
+	case syscall.ECONNREFUSED:
+		return codes.Unavailable, "connection-refused"
+	case syscall.ECONNRESET:
+		return codes.Unavailable, "connection-reset"
+	case io.EOF, io.ErrUnexpectedEOF:
+		return codes.Unavailable, "eof"
+	case context.Canceled:
+		return codes.Canceled, "canceled"
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded, "timeout"
+	}
+	if _, ok := err.(*net.DNSError); ok {
+		return codes.Unavailable, "dns"
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return codes.DeadlineExceeded, "timeout"
+	}
+	return codes.Unknown, "unknown"
+}
+
+// rootCause unwraps pkg/errors wrappers and the net and os error types that
+// wrap a lower level error, e.g. the syscall.Errno of a refused dial. A
+// timeout error is returned as is, so it's still reported as a timeout.
+func rootCause(err error) error {
+	for {
+		err = errors.Cause(err)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return err
+		}
+		switch e := err.(type) {
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case *url.Error:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
+
+// classify converts an error that isn't a gRPC status error into one,
+// logging its classification.
+func (ec *ErrorClassifier) classify(method string, err error) error {
+	if nil == err {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code, class := ClassifyError(err)
+	ec.logger().WithError(err).WithFields(log.Fields{
+		"gateway-method": method,
+		"code":           code,
+		"error-class":    class,
+	}).Warn("backend call failed with a non-status error")
+	return status.Error(code, err.Error())
+}
+
+// logger returns the classifier Logger, or the global logger if it isn't
+// set.
+func (ec *ErrorClassifier) logger() log_interceptor.Logger {
+	if nil != ec.Logger {
+		return ec.Logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
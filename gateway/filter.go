@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MethodFilter contains gRPC client interceptor methods that restrict which
+// methods can be reached through the REST gateway. Install them on the
+// gateway's connection to the gRPC server, e.g. with grpc.WithUnaryInterceptor
+// in the dial options passed to the generated Register*HandlerFromEndpoint
+// function; native gRPC clients are not affected.
+//
+// Denied calls fail with a NotFound error, which the gateway renders as a
+// 404 response, so the existence of internal methods isn't revealed.
+//
+// Entries are full method names ("/package.Service/Method") or a service
+// name followed by "/*" ("/package.Service/*") to match all methods of a
+// service.
+type MethodFilter struct {
+	Allow []string // Allow if not empty lists the only methods REST requests may call
+	Deny  []string // Deny lists the methods REST requests may not call, taking precedence over Allow
+}
+
+// UnaryClientInterceptor is a grpc client interceptor that rejects unary
+// calls to filtered methods.
+func (mf *MethodFilter) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if !mf.Allowed(method) {
+		return errFiltered
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// StreamClientInterceptor is a grpc client interceptor that rejects
+// streaming calls to filtered methods.
+func (mf *MethodFilter) StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	if !mf.Allowed(method) {
+		return nil, errFiltered
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+// errFiltered is returned for filtered calls. Its message is generic, so the
+// name of the method isn't echoed back to the client.
+var errFiltered = status.Error(codes.NotFound, "Not Found")
+
+// Allowed reports whether a full method name passes the filter.
+func (mf *MethodFilter) Allowed(method string) bool {
+	if matchMethod(mf.Deny, method) {
+		return false
+	}
+	return 0 == len(mf.Allow) || matchMethod(mf.Allow, method)
+}
+
+// matchMethod reports whether a full method name matches any of the entries.
+func matchMethod(entries []string, method string) bool {
+	for _, entry := range entries {
+		if entry == method {
+			return true
+		}
+		if strings.HasSuffix(entry, "/*") && strings.HasPrefix(method, strings.TrimSuffix(entry, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"net/textproto"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+// DefaultDenyHeaders lists the headers a HeaderMatcher never forwards: the
+// hop-by-hop headers, which only apply to a single HTTP connection, and the
+// headers describing the HTTP message itself.
+var DefaultDenyHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Host",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// DefaultDenyOutgoingHeaders lists the gRPC response metadata keys a
+// HeaderMatcher never returns as HTTP headers, in addition to
+// DefaultDenyHeaders. The gateway sets the content type itself.
+var DefaultDenyOutgoingHeaders = []string{
+	"Content-Type",
+	"Grpc-*",
+}
+
+// HeaderMatcher selects the HTTP request headers forwarded to gRPC metadata,
+// and the gRPC response metadata returned as HTTP headers.
+//
+// Entries are header names, matched case-insensitively, or a prefix followed
+// by "*" ("X-Forwarded-*") to match all headers with the prefix. Deny lists
+// take precedence over allow lists.
+type HeaderMatcher struct {
+	Allow         []string // Allow if not empty lists the only request headers forwarded to gRPC metadata
+	Deny          []string // Deny lists request headers never forwarded, in addition to DefaultDenyHeaders
+	OutgoingAllow []string // OutgoingAllow if not empty lists the only response metadata keys returned as HTTP headers
+	OutgoingDeny  []string // OutgoingDeny lists response metadata keys never returned, in addition to DefaultDenyHeaders and DefaultDenyOutgoingHeaders
+}
+
+// ServeMuxOptions returns the options installing the matcher, to pass to
+// runtime.NewServeMux.
+func (hm *HeaderMatcher) ServeMuxOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithIncomingHeaderMatcher(hm.Incoming),
+		runtime.WithOutgoingHeaderMatcher(hm.Outgoing),
+	}
+}
+
+// Incoming is a runtime.HeaderMatcherFunc mapping HTTP request headers to
+// gRPC metadata keys. Allowed headers are forwarded under their own name,
+// headers with the "Grpc-Metadata-" prefix without it.
+func (hm *HeaderMatcher) Incoming(key string) (string, bool) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if strings.HasPrefix(key, runtime.MetadataHeaderPrefix) {
+		key = strings.TrimPrefix(key, runtime.MetadataHeaderPrefix)
+	}
+	if matchHeader(DefaultDenyHeaders, key) || matchHeader(hm.Deny, key) {
+		return "", false
+	}
+	if 0 != len(hm.Allow) && !matchHeader(hm.Allow, key) {
+		return "", false
+	}
+	return key, true
+}
+
+// Outgoing is a runtime.HeaderMatcherFunc mapping gRPC response metadata
+// keys to HTTP headers. Allowed keys are returned with the "Grpc-Metadata-"
+// prefix, like the grpc-gateway default, so they can't overwrite the
+// headers set by the gateway.
+func (hm *HeaderMatcher) Outgoing(key string) (string, bool) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if matchHeader(DefaultDenyHeaders, key) || matchHeader(DefaultDenyOutgoingHeaders, key) || matchHeader(hm.OutgoingDeny, key) {
+		return "", false
+	}
+	if 0 != len(hm.OutgoingAllow) && !matchHeader(hm.OutgoingAllow, key) {
+		return "", false
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// matchHeader reports whether a canonical header name matches any of the
+// entries.
+func matchHeader(entries []string, key string) bool {
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "*") {
+			if strings.HasPrefix(strings.ToLower(key), strings.ToLower(strings.TrimSuffix(entry, "*"))) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(entry, key) {
+			return true
+		}
+	}
+	return false
+}
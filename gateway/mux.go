@@ -0,0 +1,36 @@
+package gateway
+
+import (
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+
+	httppb "github.com/bdlm/grpc-gateway-wrapper/encoding/http"
+)
+
+// NewServeMux returns a grpc-gateway multiplexer with the package defaults,
+// see DefaultServeMuxOptions. opts are applied after the defaults, so they
+// can add marshalers and override any default.
+func NewServeMux(opts ...runtime.ServeMuxOption) *runtime.ServeMux {
+	return runtime.NewServeMux(append(DefaultServeMuxOptions(), opts...)...)
+}
+
+// DefaultServeMuxOptions returns the options NewServeMux applies by default:
+//   - JSON for all content types, with default values emitted and property
+//     names as defined in the protobuf
+//   - form and multipart form data decoding, with the same JSON encoding;
+//     multipart requests are only decoded behind the middleware.MediaType
+//     middleware, which middleware.NewRouter includes
+//   - a HeaderMatcher with the default deny lists
+//   - WithErrorHandler
+func DefaultServeMuxOptions() []runtime.ServeMuxOption {
+	jsonPb := runtime.JSONPb{
+		EmitDefaults: true, // don't omit properties with default values.
+		OrigName:     true, // encode JSON properties as defined in the protobuf (don't convert to CamelCase).
+	}
+	opts := []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &jsonPb),
+		runtime.WithMarshalerOption("application/x-www-form-urlencoded", &httppb.Form{JSONPb: jsonPb}),
+		runtime.WithMarshalerOption("multipart/form-data", &httppb.Multipart{JSONPb: jsonPb}),
+		WithErrorHandler(),
+	}
+	return append(opts, (&HeaderMatcher{}).ServeMuxOptions()...)
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+
+	xmlpb "github.com/bdlm/grpc-gateway-wrapper/encoding/xml"
+	"github.com/bdlm/grpc-gateway-wrapper/middleware"
+)
+
+func TestServeMuxMultipart(t *testing.T) {
+	mux := NewServeMux()
+	var decoded *any.Any
+	pattern := runtime.MustPattern(runtime.NewPattern(1, []int{int(utilities.OpLitPush), 0}, []string{"upload"}, ""))
+	mux.Handle(http.MethodPost, pattern, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		inbound, _ := runtime.MarshalerForRequest(mux, r)
+		decoded = &any.Any{}
+		if err := inbound.NewDecoder(r.Body).Decode(decoded); nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	// the preamble holds a line that looks like a boundary delimiter, only
+	// the Content-Type header tells the real boundary.
+	body.WriteString("--preamble\r\n\r\n")
+	if err := writer.WriteField("type_url", "type.example.com/Item"); nil != err {
+		t.Fatal(err)
+	}
+	file, err := writer.CreateFormFile("value", "item.bin")
+	if nil != err {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 1, 2})
+	if err := writer.Close(); nil != err {
+		t.Fatal(err)
+	}
+	want := &any.Any{TypeUrl: "type.example.com/Item", Value: []byte{0, 1, 2}}
+
+	for _, test := range []struct {
+		name    string
+		handler http.Handler
+		code    int
+	}{
+		// without the middleware the gateway doesn't match the Content-Type
+		// and parses the body as JSON.
+		{name: "mux", handler: mux, code: http.StatusBadRequest},
+		{name: "MediaType", handler: middleware.MediaType(mux), code: http.StatusOK},
+	} {
+		decoded = nil
+		r := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body.Bytes()))
+		r.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, r)
+		if test.code != w.Code {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, w.Code, test.code, w.Body.String())
+			continue
+		}
+		if http.StatusOK == w.Code && !proto.Equal(want, decoded) {
+			t.Errorf("%s: decoded %v, want %v", test.name, decoded, want)
+		}
+	}
+}
+
+func TestServeMuxXMLCharset(t *testing.T) {
+	mux := NewServeMux(runtime.WithMarshalerOption("text/xml", &xmlpb.XML{}))
+	var decoded *descriptor.FileDescriptorProto
+	pattern := runtime.MustPattern(runtime.NewPattern(1, []int{int(utilities.OpLitPush), 0}, []string{"files"}, ""))
+	mux.Handle(http.MethodPost, pattern, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		inbound, _ := runtime.MarshalerForRequest(mux, r)
+		decoded = &descriptor.FileDescriptorProto{}
+		if err := inbound.NewDecoder(r.Body).Decode(decoded); nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+	handler := middleware.MediaType(mux)
+
+	// a Latin-1 document without an XML declaration, only the Content-Type
+	// header tells its charset.
+	body := []byte("<FileDescriptorProto><name>caf\xe9.proto</name></FileDescriptorProto>")
+	want := &descriptor.FileDescriptorProto{Name: proto.String("caf\u00e9.proto")}
+
+	for _, contentType := range []string{"text/xml; charset=ISO-8859-1", `text/xml; charset="iso-8859-1"`} {
+		decoded = nil
+		r := httptest.NewRequest(http.MethodPost, "/files", bytes.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if http.StatusOK != w.Code {
+			t.Errorf("%s: got status %d: %s", contentType, w.Code, w.Body.String())
+			continue
+		}
+		if !proto.Equal(want, decoded) {
+			t.Errorf("%s: decoded %v, want %v", contentType, decoded, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+// ResponseOption is a function called with each response message before it is
+// written to the HTTP response, typically to set response headers. Returning
+// an error aborts the response with that error.
+type ResponseOption func(ctx context.Context, w http.ResponseWriter, resp proto.Message) error
+
+// WithResponseOptions returns a ServeMuxOption that calls the ResponseOption
+// registered for the type of each response message. options maps fully
+// qualified message names (e.g. "grpc.gateway.wrapper.ProbeResult") to the
+// option for responses of that type, so an option applies to every method
+// returning the message type.
+//
+// Streaming responses call the option for every message of the stream. Only
+// headers set for the first message are sent, as the response headers are
+// written with the first chunk; headers set for later messages are ignored,
+// and an error returned for a later message ends the stream with an error
+// chunk.
+//
+// Options are keyed by message type because the gateway calls forward
+// response options with the response message alone; the method and route
+// pattern aren't available to them. Methods that need different options,
+// e.g. a cacheable read and an uncacheable one, should return distinct
+// message types.
+func WithResponseOptions(options map[string]ResponseOption) runtime.ServeMuxOption {
+	return runtime.WithForwardResponseOption(func(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+		if nil == resp {
+			return nil
+		}
+		if option, ok := options[proto.MessageName(resp)]; ok && nil != option {
+			return option(ctx, w, resp)
+		}
+		return nil
+	})
+}
+
+// CacheControl returns a ResponseOption that sets the Cache-Control header of
+// the response, e.g. "public, max-age=60" for idempotent reads that can be
+// cached.
+func CacheControl(value string) ResponseOption {
+	return func(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+		w.Header().Set("Cache-Control", value)
+		return nil
+	}
+}
@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bdlm/log"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// Route describes an HTTP method and path pattern served by a router.
+type Route struct {
+	Method  string
+	Pattern string
+}
+
+// SwaggerRoutes returns the gateway routes described by the "paths" object of
+// an OpenAPI v2 document, such as the *.swagger.json files generated by
+// protoc-gen-swagger.
+func SwaggerRoutes(data []byte) ([]Route, error) {
+	doc := struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}{}
+	if err := json.Unmarshal(data, &doc); nil != err {
+		return nil, errors.Wrap(err, "could not decode swagger document")
+	}
+
+	routes := []Route{}
+	for pattern, methods := range doc.Paths {
+		for method := range methods {
+			if strings.HasPrefix(method, "x-") || "parameters" == method {
+				continue
+			}
+			routes = append(routes, Route{Method: strings.ToUpper(method), Pattern: pattern})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern == routes[j].Pattern {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes, nil
+}
+
+// ValidateRoutes compares the native routes registered on the chi router with
+// the gateway routes and logs an error, to logger or to the global logger if
+// it is nil, for every native route that can match the same requests as a
+// gateway route, and would therefore shadow it. It returns an error if any
+// conflict was found and should be called at startup, after all routes have
+// been registered.
+//
+// Path parameters, chi wildcards and gateway variables and wildcards are
+// treated as matching any value, so the check is conservative: patterns such
+// as "/v1/{name}" and "/v1/status" are reported as a conflict. The catch-all
+// "/*" route the gateway multiplexer is mounted on is ignored.
+func ValidateRoutes(logger log_interceptor.Logger, router chi.Routes, gateway []Route) error {
+	if nil == logger {
+		logger = log_interceptor.NewLogger(nil)
+	}
+	conflicts := 0
+	err := chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		native := nativeSegments(route)
+		if 1 == len(native) && native[0].rest {
+			return nil
+		}
+		for _, gw := range gateway {
+			if method != gw.Method || !overlap(native, gatewaySegments(gw.Pattern)) {
+				continue
+			}
+			conflicts++
+			logger.WithFields(log.Fields{
+				"http-method":   method,
+				"native-route":  route,
+				"gateway-route": gw.Pattern,
+			}).Error("native route conflicts with gateway route")
+		}
+		return nil
+	})
+	if nil != err {
+		return errors.Wrap(err, "could not walk router")
+	}
+	if conflicts > 0 {
+		return errors.Errorf("%d native routes conflict with gateway routes", conflicts)
+	}
+	return nil
+}
+
+// segment is a single path segment of a route pattern.
+type segment struct {
+	literal string
+	any     bool // matches any single segment
+	rest    bool // matches all remaining segments
+}
+
+// nativeSegments parses a chi route pattern, e.g. "/v1/{id}/*".
+func nativeSegments(pattern string) []segment {
+	segments := []segment{}
+	for _, part := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		switch {
+		case "*" == part:
+			segments = append(segments, segment{rest: true})
+		case strings.Contains(part, "{"):
+			segments = append(segments, segment{any: true})
+		default:
+			segments = append(segments, segment{literal: part})
+		}
+	}
+	return segments
+}
+
+// gatewaySegments parses a grpc-gateway path template, e.g.
+// "/v1/{name=projects/*}/items/**". Variables with a path are expanded into
+// their path segments.
+func gatewaySegments(pattern string) []segment {
+	parts := []string{}
+	depth, start := 0, 0
+	pattern = strings.Trim(pattern, "/")
+	for i, c := range pattern {
+		switch {
+		case '{' == c:
+			depth++
+		case '}' == c:
+			depth--
+		case '/' == c && 0 == depth:
+			parts = append(parts, pattern[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, pattern[start:])
+
+	segments := []segment{}
+	for _, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.Contains(part, "=") && strings.HasSuffix(part, "}") {
+			sub := part[strings.Index(part, "=")+1 : len(part)-1]
+			segments = append(segments, gatewaySegments(sub)...)
+			continue
+		}
+		switch {
+		case "**" == part:
+			segments = append(segments, segment{rest: true})
+		case "*" == part || strings.Contains(part, "{"):
+			segments = append(segments, segment{any: true})
+		default:
+			segments = append(segments, segment{literal: part})
+		}
+	}
+	return segments
+}
+
+// overlap reports whether any request path can match both patterns.
+func overlap(a, b []segment) bool {
+	switch {
+	case 0 == len(a):
+		return 0 == len(b) || b[0].rest
+	case 0 == len(b):
+		return a[0].rest
+	case a[0].rest || b[0].rest:
+		return true
+	case a[0].any || b[0].any || a[0].literal == b[0].literal:
+		return overlap(a[1:], b[1:])
+	}
+	return false
+}
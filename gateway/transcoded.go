@@ -0,0 +1,76 @@
+// Package gateway contains helpers for configuring the grpc-gateway REST
+// multiplexer and the gRPC services behind it.
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TranscodedKey is the gRPC metadata key used to mark requests that arrived
+// through the REST gateway.
+const TranscodedKey = "x-gateway-transcoded"
+
+// WithTranscodedMarker returns a ServeMuxOption that marks every request
+// forwarded by the multiplexer by adding the TranscodedKey metadata to the
+// outgoing gRPC request, so the gRPC server can distinguish REST traffic from
+// native gRPC traffic with IsTranscoded.
+//
+// The marker is ordinary metadata: native gRPC clients can send it too. It is
+// meant for applying additional policies to REST traffic (CSRF checks,
+// browser rate limits), which a native client can only opt itself into, and
+// must not be used to grant REST requests anything native requests don't get.
+func WithTranscodedMarker() runtime.ServeMuxOption {
+	return runtime.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+		return metadata.Pairs(TranscodedKey, "true")
+	})
+}
+
+// IsTranscoded reports whether the request in ctx was marked by
+// WithTranscodedMarker as having arrived through the REST gateway.
+func IsTranscoded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(TranscodedKey)
+	return 0 < len(values) && "true" == values[0]
+}
+
+// TranscodedUnaryInterceptor returns a unary interceptor that applies
+// interceptor to REST-transcoded requests only. Native gRPC requests are
+// passed straight to the handler.
+func TranscodedUnaryInterceptor(interceptor grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if !IsTranscoded(ctx) {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// TranscodedStreamInterceptor returns a stream interceptor that applies
+// interceptor to REST-transcoded requests only. Native gRPC requests are
+// passed straight to the handler.
+func TranscodedStreamInterceptor(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if !IsTranscoded(stream.Context()) {
+			return handler(srv, stream)
+		}
+		return interceptor(srv, stream, info, handler)
+	}
+}
@@ -0,0 +1,145 @@
+// Package auth contains interceptor/middleware helpers for authenticating
+// requests.
+package auth
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/bdlm/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// AuthFunc validates a request token. The returned context, e.g. carrying the
+// token claims, is passed to the handler. Errors are returned to the client
+// as Unauthenticated, unless they are gRPC status errors, e.g. to return
+// PermissionDenied.
+type AuthFunc func(ctx context.Context, token string) (context.Context, error)
+
+// Interceptor contains gRPC interceptor middleware methods that authenticate
+// requests with the token in the "authorization" metadata header, rejecting
+// requests that fail authentication with an Unauthenticated error.
+type Interceptor struct {
+	AuthFunc    AuthFunc               // AuthFunc if set will validate the token of each request; all requests are rejected if nil
+	Logger      log_interceptor.Logger // Logger if set will be logged to instead of the global logger
+	SkipMethods []string               // SkipMethods if set will bypass authentication for these full method names ("/package.Service/Method"), e.g. probes
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that authenticates
+// requests before calling the handler.
+func (ai *Interceptor) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if ai.skipped(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := ai.authenticate(ctx, info.FullMethod)
+	if nil != err {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor is a grpc interceptor middleware that authenticates
+// streams before calling the handler.
+func (ai *Interceptor) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if ai.skipped(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	ctx, err := ai.authenticate(stream.Context(), info.FullMethod)
+	if nil != err {
+		return err
+	}
+	return handler(srv, &authenticatedServerStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticate validates the request token with AuthFunc.
+func (ai *Interceptor) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	token := Token(ctx)
+	if "" == token {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+	if nil == ai.AuthFunc {
+		return nil, status.Error(codes.Unauthenticated, "authentication is not configured")
+	}
+	newCtx, err := ai.AuthFunc(ctx, token)
+	if nil != err {
+		ai.logger().WithFields(log.Fields{
+			"gateway-service": path.Dir(fullMethod)[1:],
+			"gateway-method":  path.Base(fullMethod),
+			"error-message":   err.Error(),
+		}).Debug("authentication failed")
+		if _, ok := status.FromError(err); ok && codes.Unknown != status.Code(err) {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization token")
+	}
+	if nil == newCtx {
+		newCtx = ctx
+	}
+	return newCtx, nil
+}
+
+// logger returns the interceptor Logger, or the global logger if it isn't
+// set.
+func (ai *Interceptor) logger() log_interceptor.Logger {
+	if nil != ai.Logger {
+		return ai.Logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
+
+// skipped reports whether a method bypasses authentication.
+func (ai *Interceptor) skipped(fullMethod string) bool {
+	for _, method := range ai.SkipMethods {
+		if method == fullMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// Token returns the token in the "authorization" metadata header of an
+// incoming request, without the "Bearer " scheme prefix.
+func Token(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if 0 == len(values) {
+		return ""
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) > 7 && strings.EqualFold("bearer ", token[:7]) {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+// authenticatedServerStream wraps a ServerStream in order to pass the context
+// returned by AuthFunc to the handler.
+type authenticatedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context lets authenticatedServerStream implement ServerStream, and will
+// return the authenticated context.
+func (s *authenticatedServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,255 @@
+// Package cache contains interceptor/middleware helpers for caching responses
+// of idempotent read methods.
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/bdlm/log"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// Cache is a response cache. Values are serialized responses, so
+// implementations can be backed by an external store.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// Interceptor contains gRPC interceptor middleware methods that cache the
+// responses of an allowlist of idempotent methods for a short time, keyed by
+// the method and a hash of the serialized request message, and return cached
+// responses without calling the handler (or, on the client side, the
+// backend). Only successful responses are cached.
+//
+// Cached responses are not invalidated when the underlying data changes; they
+// are served until their TTL expires, so TTLs should be no longer than the
+// staleness clients can tolerate. Responses that depend on anything other
+// than the request message, such as the caller's identity in the metadata,
+// must add it to the key with the Key function, or they are served to other
+// callers.
+type Interceptor struct {
+	Cache   Cache                            // Cache stores the responses
+	Key     func(ctx context.Context) string // Key if set returns an additional cache key component for a request, e.g. the authenticated user
+	Logger  log_interceptor.Logger           // Logger if set will be logged to instead of the global logger
+	Methods map[string]time.Duration         // Methods maps the full names ("/package.Service/Method") of the cached methods to their TTL
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that serves cached
+// responses.
+func (ci *Interceptor) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ttl, key, ok := ci.key(ctx, info.FullMethod, req)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	if value, ok := ci.Cache.Get(key); ok {
+		if resp, err := decode(value); nil == err {
+			ci.logCache(info.FullMethod, "hit")
+			return resp, nil
+		}
+	}
+	ci.logCache(info.FullMethod, "miss")
+
+	resp, err := handler(ctx, req)
+	if nil == err {
+		if pb, ok := resp.(proto.Message); ok {
+			if value, err := encode(pb); nil == err {
+				ci.Cache.Set(key, value, ttl)
+			}
+		}
+	}
+	return resp, err
+}
+
+// UnaryClientInterceptor is a grpc client interceptor that serves cached
+// responses, e.g. on the gateway's connection to the gRPC server.
+func (ci *Interceptor) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	ttl, key, ok := ci.key(ctx, method, req)
+	pb, isProto := reply.(proto.Message)
+	if !ok || !isProto {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	if value, ok := ci.Cache.Get(key); ok {
+		if resp, err := decode(value); nil == err && reflect.TypeOf(resp) == reflect.TypeOf(pb) {
+			pb.Reset()
+			proto.Merge(pb, resp)
+			ci.logCache(method, "hit")
+			return nil
+		}
+	}
+	ci.logCache(method, "miss")
+
+	if err := invoker(ctx, method, req, reply, cc, opts...); nil != err {
+		return err
+	}
+	if value, err := encode(pb); nil == err {
+		ci.Cache.Set(key, value, ttl)
+	}
+	return nil
+}
+
+// key returns the TTL and cache key of a request, if the method is cached.
+func (ci *Interceptor) key(ctx context.Context, fullMethod string, req interface{}) (time.Duration, string, bool) {
+	ttl, ok := ci.Methods[fullMethod]
+	if !ok || ttl <= 0 || nil == ci.Cache {
+		return 0, "", false
+	}
+	pb, ok := req.(proto.Message)
+	if !ok {
+		return 0, "", false
+	}
+
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(pb); nil != err {
+		return 0, "", false
+	}
+	hash := sha256.New()
+	hash.Write(buf.Bytes())
+	if nil != ci.Key {
+		hash.Write([]byte{0})
+		hash.Write([]byte(ci.Key(ctx)))
+	}
+	return ttl, fullMethod + ":" + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)), true
+}
+
+// encode serializes a response with its message type name.
+func encode(pb proto.Message) ([]byte, error) {
+	value, err := proto.Marshal(pb)
+	if nil != err {
+		return nil, err
+	}
+	return append([]byte(proto.MessageName(pb)+"\x00"), value...), nil
+}
+
+// decode deserializes a response encoded by encode.
+func decode(value []byte) (proto.Message, error) {
+	k := bytes.IndexByte(value, 0)
+	if k < 0 {
+		return nil, errInvalidValue
+	}
+	typ := proto.MessageType(string(value[:k]))
+	if nil == typ {
+		return nil, errInvalidValue
+	}
+	pb, ok := reflect.New(typ.Elem()).Interface().(proto.Message)
+	if !ok {
+		return nil, errInvalidValue
+	}
+	if err := proto.Unmarshal(value[k+1:], pb); nil != err {
+		return nil, err
+	}
+	return pb, nil
+}
+
+// logCache logs a cache lookup.
+func (ci *Interceptor) logCache(fullMethod, result string) {
+	ci.logger().WithFields(log.Fields{
+		"gateway-service": path.Dir(fullMethod)[1:],
+		"gateway-method":  path.Base(fullMethod),
+		"cache":           result,
+	}).Debug("response cache lookup")
+}
+
+// logger returns the interceptor Logger, or the global logger if it isn't
+// set.
+func (ci *Interceptor) logger() log_interceptor.Logger {
+	if nil != ci.Logger {
+		return ci.Logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
+
+// MemoryCache is an in-process Cache. The zero value is ready to use. Once
+// it holds MaxEntries values, setting another evicts the least recently used
+// one; expired values are dropped when they are read or evicted.
+type MemoryCache struct {
+	MaxEntries int // MaxEntries is the maximum number of values, 1000 if 0
+
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // front is the most recently used *memoryEntry
+}
+
+// memoryEntry is a value stored in a MemoryCache.
+type memoryEntry struct {
+	key     string
+	expires time.Time
+	value   []byte
+}
+
+// Get returns an unexpired value.
+func (mc *MemoryCache) Get(key string) ([]byte, bool) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	elem, ok := mc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		mc.remove(elem)
+		return nil, false
+	}
+	mc.lru.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores a value until its TTL expires.
+func (mc *MemoryCache) Set(key string, value []byte, ttl time.Duration) {
+	max := mc.MaxEntries
+	if max <= 0 {
+		max = 1000
+	}
+
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	if nil == mc.entries {
+		mc.entries = map[string]*list.Element{}
+	}
+	entry := &memoryEntry{key: key, expires: time.Now().Add(ttl), value: value}
+	if elem, ok := mc.entries[key]; ok {
+		elem.Value = entry
+		mc.lru.MoveToFront(elem)
+		return
+	}
+	for len(mc.entries) >= max {
+		mc.remove(mc.lru.Back())
+	}
+	mc.entries[key] = mc.lru.PushFront(entry)
+}
+
+// remove deletes an element from the cache.
+func (mc *MemoryCache) remove(elem *list.Element) {
+	mc.lru.Remove(elem)
+	delete(mc.entries, elem.Value.(*memoryEntry).key)
+}
+
+// errInvalidValue is returned for cached values that can't be decoded.
+var errInvalidValue = errors.New("invalid cached value")
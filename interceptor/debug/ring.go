@@ -0,0 +1,143 @@
+// Package debug contains interceptor/middleware helpers for inspecting recent
+// requests while debugging.
+package debug
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Entry is a request recorded by the RingBuffer.
+type Entry struct {
+	Code     string          `json:"code"`
+	Elapsed  int64           `json:"elapsed"` // nanoseconds
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Start    time.Time       `json:"start"`
+}
+
+// RingBuffer contains a gRPC interceptor middleware method that records the
+// most recent unary requests and responses in memory, and an HTTP handler
+// serving them. Payloads can contain sensitive data, so the handler should
+// only be mounted on an internal router.
+//
+// Entries are evicted when the buffer holds Size newer entries or, if MaxAge
+// is set, once they are older than MaxAge, so that on low traffic services
+// the buffer doesn't show requests from hours ago. Expired entries are
+// cleared, releasing their payloads, whenever an entry is recorded or the
+// entries are read.
+type RingBuffer struct {
+	MaxAge time.Duration // MaxAge if non-zero evicts entries older than this
+	Size   int           // Size is the maximum number of entries, 100 if 0
+
+	mux     sync.Mutex
+	entries []Entry
+	next    int
+}
+
+// marshaler is the marshaler used for serializing payloads.
+var marshaler = &jsonpb.Marshaler{OrigName: true}
+
+// UnaryInterceptor is a grpc interceptor middleware that records each request
+// and response.
+func (rb *RingBuffer) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	rb.add(Entry{
+		Code:     status.Code(err).String(),
+		Elapsed:  time.Since(start).Nanoseconds(),
+		Method:   info.FullMethod,
+		Request:  payload(req),
+		Response: payload(resp),
+		Start:    start,
+	})
+	return resp, err
+}
+
+// Handler serves the unexpired entries as JSON, newest first.
+func (rb *RingBuffer) Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(rb.Entries())
+}
+
+// Entries returns the unexpired entries, newest first.
+func (rb *RingBuffer) Entries() []Entry {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	rb.evict()
+
+	entries := make([]Entry, 0, len(rb.entries))
+	for k := 1; k <= len(rb.entries); k++ {
+		entry := rb.entries[(rb.next-k+len(rb.entries))%len(rb.entries)]
+		if entry.Start.IsZero() {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// add records an entry, overwriting the oldest entry once the buffer is
+// full.
+func (rb *RingBuffer) add(entry Entry) {
+	size := rb.Size
+	if size <= 0 {
+		size = 100
+	}
+
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	rb.evict()
+	if len(rb.entries) < size {
+		rb.entries = append(rb.entries, entry)
+		rb.next = len(rb.entries) % size
+		return
+	}
+	rb.entries[rb.next] = entry
+	rb.next = (rb.next + 1) % len(rb.entries)
+}
+
+// evict clears the entries older than MaxAge, leaving empty slots with a zero
+// Start. Entries are recorded as requests complete, so an older entry can
+// have started after an expired one and all slots are checked. The caller
+// must hold the lock.
+func (rb *RingBuffer) evict() {
+	if rb.MaxAge <= 0 {
+		return
+	}
+	for k := range rb.entries {
+		if start := rb.entries[k].Start; !start.IsZero() && time.Since(start) > rb.MaxAge {
+			rb.entries[k] = Entry{}
+		}
+	}
+}
+
+// payload returns the JSON representation of a message, or nil.
+func payload(v interface{}) json.RawMessage {
+	pb, ok := v.(proto.Message)
+	if !ok || nil == pb {
+		return nil
+	}
+	b := &bytes.Buffer{}
+	if err := marshaler.Marshal(b, pb); nil != err {
+		return nil
+	}
+	return b.Bytes()
+}
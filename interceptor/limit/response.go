@@ -0,0 +1,115 @@
+// Package limit contains interceptor/middleware helpers for enforcing
+// resource limits.
+package limit
+
+import (
+	"context"
+	"path"
+
+	"github.com/bdlm/log"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// ResponseSize contains gRPC interceptor middleware methods that replace
+// responses larger than a configured size with a ResourceExhausted error.
+type ResponseSize struct {
+	Default int                    // Default is the maximum response size in bytes for methods without an entry in Methods, 0 for unlimited
+	Logger  log_interceptor.Logger // Logger if set will be logged to instead of the global logger
+	Methods map[string]int         // Methods maps full method names ("/package.Service/Method") to their maximum response size in bytes, 0 for unlimited
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that checks the size of
+// the response returned by the handler.
+func (rs *ResponseSize) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if nil != err {
+		return resp, err
+	}
+	if err := rs.check(info.FullMethod, resp); nil != err {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StreamInterceptor is a grpc interceptor middleware that checks the size of
+// each message sent on the stream.
+func (rs *ResponseSize) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if 0 == rs.limit(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	return handler(srv, &responseSizeServerStream{ServerStream: stream, fullMethod: info.FullMethod, rs: rs})
+}
+
+// limit returns the maximum response size for a method.
+func (rs *ResponseSize) limit(fullMethod string) int {
+	if limit, ok := rs.Methods[fullMethod]; ok {
+		return limit
+	}
+	return rs.Default
+}
+
+// check returns a ResourceExhausted error if the message exceeds the
+// method's maximum response size.
+func (rs *ResponseSize) check(fullMethod string, msg interface{}) error {
+	limit := rs.limit(fullMethod)
+	if 0 == limit {
+		return nil
+	}
+	pb, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	size := proto.Size(pb)
+	if size <= limit {
+		return nil
+	}
+
+	rs.logger().WithFields(log.Fields{
+		"gateway-service": path.Dir(fullMethod)[1:],
+		"gateway-method":  path.Base(fullMethod),
+		"limit":           limit,
+		"size":            size,
+	}).Warn("response exceeds size limit")
+	return status.Errorf(codes.ResourceExhausted, "response size %d exceeds the limit of %d bytes", size, limit)
+}
+
+// logger returns the ResponseSize Logger, or the global logger if it isn't
+// set.
+func (rs *ResponseSize) logger() log_interceptor.Logger {
+	if nil != rs.Logger {
+		return rs.Logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
+
+// responseSizeServerStream wraps a ServerStream in order to check the size of
+// each sent message.
+type responseSizeServerStream struct {
+	grpc.ServerStream
+	fullMethod string
+	rs         *ResponseSize
+}
+
+// SendMsg lets responseSizeServerStream implement ServerStream, and will
+// reject oversized messages.
+func (s *responseSizeServerStream) SendMsg(m interface{}) error {
+	if err := s.rs.check(s.fullMethod, m); nil != err {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,110 @@
+package limit
+
+import (
+	"context"
+	"net"
+	"path"
+	"sync"
+
+	"github.com/bdlm/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// ClientStreams contains gRPC interceptor middleware methods that limit the
+// number of streams each client can have open at the same time, rejecting
+// new streams beyond the limit with a ResourceExhausted error.
+type ClientStreams struct {
+	Key    func(ctx context.Context) string // Key returns the client key of a stream, e.g. an API key from the metadata; PeerIP if nil
+	Logger log_interceptor.Logger           // Logger if set will be logged to instead of the global logger
+	Max    int                              // Max is the maximum number of open streams per client, 0 for unlimited
+
+	mux  sync.Mutex
+	open map[string]int
+}
+
+// StreamInterceptor is a grpc interceptor middleware that counts the open
+// streams of each client.
+func (cs *ClientStreams) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if cs.Max <= 0 {
+		return handler(srv, stream)
+	}
+
+	keyFunc := cs.Key
+	if nil == keyFunc {
+		keyFunc = PeerIP
+	}
+	key := keyFunc(stream.Context())
+
+	if !cs.acquire(key) {
+		cs.logger().WithFields(log.Fields{
+			"gateway-service": path.Dir(info.FullMethod)[1:],
+			"gateway-method":  path.Base(info.FullMethod),
+			"client":          key,
+			"limit":           cs.Max,
+		}).Warn("client exceeds open stream limit")
+		return status.Errorf(codes.ResourceExhausted, "too many open streams: the limit is %d per client", cs.Max)
+	}
+	// release in a defer so streams ending in an error or a panic are
+	// accounted for.
+	defer cs.release(key)
+
+	return handler(srv, stream)
+}
+
+// logger returns the ClientStreams Logger, or the global logger if it isn't
+// set.
+func (cs *ClientStreams) logger() log_interceptor.Logger {
+	if nil != cs.Logger {
+		return cs.Logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
+
+// acquire counts a new stream for a client, unless the client is at the limit.
+func (cs *ClientStreams) acquire(key string) bool {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	if nil == cs.open {
+		cs.open = map[string]int{}
+	}
+	if cs.open[key] >= cs.Max {
+		return false
+	}
+	cs.open[key]++
+	return true
+}
+
+// release counts a closed stream for a client.
+func (cs *ClientStreams) release(key string) {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	if cs.open[key] <= 1 {
+		delete(cs.open, key)
+		return
+	}
+	cs.open[key]--
+}
+
+// PeerIP returns the IP address of the peer of a request, or an empty string
+// if it is unknown.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || nil == p.Addr {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if nil != err {
+		return p.Addr.String()
+	}
+	return host
+}
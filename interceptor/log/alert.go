@@ -0,0 +1,67 @@
+package log
+
+import (
+	"github.com/bdlm/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+)
+
+// AlertHook is a log hook that passes the interceptor's error level response
+// entries to an alerting function, so alerts can be raised from the existing
+// access logs in real time.
+//
+// For example, to post Internal and DataLoss errors to a chat channel:
+//
+//	log_interceptor.InstallAlertHook(logger, func(entry *log.Entry) error {
+//		return chat.Post(fmt.Sprintf(
+//			"%s/%s failed with %v: %s",
+//			entry.Data["gateway-service"],
+//			entry.Data["gateway-method"],
+//			entry.Data["code"],
+//			entry.Message,
+//		))
+//	}, codes.Internal, codes.DataLoss)
+type AlertHook struct {
+	Alert func(entry *log.Entry) error // Alert is called with each matching entry; it runs synchronously, so slow alerting should be made asynchronous
+	Codes []codes.Code                 // Codes limits alerts to entries with these response codes, all error entries if empty
+}
+
+// InstallAlertHook adds an AlertHook calling alert for error level entries
+// with one of the given codes, or with any code if none are given, to logger,
+// or to the global logger if it is nil. Hooks can only be added to loggers
+// returned by NewLogger.
+func InstallAlertHook(logger Logger, alert func(entry *log.Entry) error, filter ...codes.Code) (*AlertHook, error) {
+	hook := &AlertHook{Alert: alert, Codes: filter}
+	target, ok := loggerOrDefault(logger).(*entryLogger)
+	if !ok {
+		return nil, errors.New("alert hooks can only be added to loggers returned by NewLogger")
+	}
+	target.addHook(hook)
+	return hook, nil
+}
+
+// Levels returns the levels the hook fires for.
+func (h *AlertHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+// Fire calls the Alert function if the entry is an interceptor entry with a
+// matching response code.
+func (h *AlertHook) Fire(entry *log.Entry) error {
+	if nil == h.Alert {
+		return nil
+	}
+	code, ok := entry.Data["code"].(codes.Code)
+	if !ok {
+		return nil
+	}
+	if 0 == len(h.Codes) {
+		return h.Alert(entry)
+	}
+	for _, c := range h.Codes {
+		if c == code {
+			return h.Alert(entry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bdlm/log"
+	std "github.com/bdlm/std/logger"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+)
+
+// streamLogRecord is a buffered stream message log entry.
+type streamLogRecord struct {
+	fields log.Fields
+	level  std.Level
+}
+
+// log logs a sent or received stream message, or buffers the entry if stream
+// log batching is enabled. Buffered messages are encoded right away, as the
+// handler may modify or reuse them before the batch is written, and keep the
+// time they were sent or received.
+func (l *loggingServerStream) log(m interface{}, code codes.Code, msg string) {
+	if l.li.StreamLogBatchSize <= 1 {
+		l.li.logProtoMessageAsJSON(l.entry, m, code, "value", msg)
+		return
+	}
+
+	fields := log.Fields{}
+	if p, ok := m.(proto.Message); ok {
+		if l.li.MaxPayloadBytes > 0 {
+			fields = payloadFields("value", p, l.li.MaxPayloadBytes)
+		} else if data, err := (&jsonpbMarshaler{p}).MarshalJSON(); nil != err {
+			fields["value"] = err.Error()
+		} else {
+			fields["value"] = json.RawMessage(data)
+		}
+	}
+	fields["code"] = code.String()
+	fields["msg"] = msg
+	fields["time"] = time.Now()
+
+	var batch []streamLogRecord
+	l.bufMux.Lock()
+	l.buf = append(l.buf, streamLogRecord{fields: fields, level: l.li.level(code)})
+	if len(l.buf) >= l.li.StreamLogBatchSize {
+		batch = l.take()
+	} else if l.li.StreamLogFlushInterval > 0 && nil == l.timer {
+		l.timer = time.AfterFunc(l.li.StreamLogFlushInterval, l.flush)
+	}
+	l.bufMux.Unlock()
+	l.write(batch)
+}
+
+// flush writes all buffered stream log entries.
+func (l *loggingServerStream) flush() {
+	l.bufMux.Lock()
+	batch := l.take()
+	l.bufMux.Unlock()
+	l.write(batch)
+}
+
+// take returns and clears the buffered stream log entries. The caller must
+// hold the buffer lock.
+func (l *loggingServerStream) take() []streamLogRecord {
+	if nil != l.timer {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	batch := l.buf
+	l.buf = nil
+	return batch
+}
+
+// write writes a batch of stream log entries as a single entry holding the
+// messages in order, at the most severe level of the batch. Batches are
+// written outside of the buffer lock, so a batch flushed by the timer may be
+// written after a later one; each message keeps its own time.
+func (l *loggingServerStream) write(batch []streamLogRecord) {
+	if 0 == len(batch) {
+		return
+	}
+	level := batch[0].level
+	messages := make([]log.Fields, len(batch))
+	for k, record := range batch {
+		if record.level < level {
+			level = record.level
+		}
+		messages[k] = record.fields
+	}
+	levelLog(l.entry.WithField("messages", messages), level, "stream messages")
+}
@@ -0,0 +1,32 @@
+package log
+
+// CancelPolicy defines how responses to requests cancelled by the client are
+// logged. A request counts as cancelled by the client if it failed while the
+// request context seen by the interceptor was cancelled, e.g. because the
+// client disconnected while the handler was waiting on a backend and failed
+// with code=Canceled, DeadlineExceeded or Unavailable. Requests whose
+// deadline expired don't count as cancelled, nor do requests failing with
+// code=Canceled while the client is still connected.
+//
+// The Interceptor must be chained before any interceptor that cancels the
+// request context itself, such as server.BaseContext on shutdown, or it
+// logs those server aborts as client cancellations.
+type CancelPolicy int
+
+const (
+	// CancelDefault logs cancelled requests like any other response, with
+	// code=Canceled.
+	CancelDefault CancelPolicy = iota
+
+	// CancelMark logs cancelled requests with a "client cancelled" message and
+	// a "cancelled" field set to true, so they can be told apart from server
+	// errors.
+	CancelMark
+
+	// CancelSuppress doesn't log responses to cancelled requests.
+	CancelSuppress
+
+	// CancelDebug logs cancelled requests like CancelMark, but at debug
+	// level, whatever the response code.
+	CancelDebug
+)
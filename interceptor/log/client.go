@@ -0,0 +1,124 @@
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bdlm/log"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor is a grpc client interceptor middleware that logs
+// out outgoing requests as they are sent and their responses as they come
+// back, e.g. the gateway's calls to the backend, using the same fields as
+// the server interceptors and the "target" the connection dials.
+func (li *Interceptor) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if li.skipped(method) {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	start := time.Now()
+	fields := li.baseFields(method)
+	fields["target"] = cc.Target()
+
+	sampled := li.sampled(ctx, method)
+	if sampled {
+		if pb, ok := req.(proto.Message); ok && li.LogUnaryReqMsg {
+			for k, v := range payloadFields("gateway-request", pb, li.MaxPayloadBytes) {
+				fields[k] = v
+			}
+		}
+		if !li.SingleLine {
+			li.logger().WithFields(log.Fields(fields)).Info("request (unary client)")
+		}
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if sampled || li.logUnsampled(err) {
+		li.logClientResponse(fields, start, err, "response (unary client)")
+	}
+	return err
+}
+
+// StreamClientInterceptor is a grpc client interceptor middleware that logs
+// out outgoing streams as they are opened and their status once they end.
+// The status is only logged once the stream has been read until it ends, or
+// once the response of a client-streaming call has been received.
+func (li *Interceptor) StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	if li.skipped(method) {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	start := time.Now()
+	fields := li.baseFields(method)
+	fields["target"] = cc.Target()
+
+	sampled := li.sampled(ctx, method)
+	if sampled && !li.SingleLine {
+		li.logger().WithFields(log.Fields(fields)).Info("request (stream client)")
+	}
+
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if nil != err {
+		li.logClientResponse(fields, start, err, "response (stream client)")
+		return nil, err
+	}
+	return &loggingClientStream{
+		ClientStream:  stream,
+		serverStreams: desc.ServerStreams,
+		done: func(err error) {
+			if sampled || li.logUnsampled(err) {
+				li.logClientResponse(fields, start, err, "response (stream client)")
+			}
+		},
+	}, nil
+}
+
+// logClientResponse logs the status and elapsed time of an outgoing request.
+func (li *Interceptor) logClientResponse(fields map[string]interface{}, start time.Time, err error, msg string) {
+	code := status.Code(err)
+	entry := li.logger().WithFields(log.Fields(fields)).WithFields(log.Fields{
+		"code":    code,
+		"elapsed": time.Since(start).Nanoseconds(),
+		"start":   start.Format(time.RFC3339Nano),
+	}).WithFields(log.Fields(li.errorFields(err)))
+	levelLog(entry, li.level(code), msg)
+}
+
+// loggingClientStream wraps a ClientStream in order to log the stream status
+// once it ends.
+type loggingClientStream struct {
+	grpc.ClientStream
+	serverStreams bool // serverStreams is false for client-streaming calls, which end with their single response
+	done          func(err error)
+	once          sync.Once
+}
+
+// RecvMsg lets loggingClientStream implement ClientStream, and will log the
+// stream status once the stream ends.
+func (l *loggingClientStream) RecvMsg(m interface{}) error {
+	err := l.ClientStream.RecvMsg(m)
+	switch {
+	case nil == err && !l.serverStreams, io.EOF == err:
+		l.once.Do(func() { l.done(nil) })
+	case nil != err:
+		l.once.Do(func() { l.done(err) })
+	}
+	return err
+}
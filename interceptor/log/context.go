@@ -0,0 +1,34 @@
+package log
+
+import (
+	"context"
+	"sync"
+)
+
+// ctxKey is the key to use to lookup the logging fields in the context.
+type ctxKey struct{}
+
+// ctxFields holds the log fields of a request, shared through the request
+// context with the handler and any stream wrappers.
+type ctxFields struct {
+	mux    sync.Mutex
+	fields map[string]interface{}
+}
+
+// withFields returns a context holding the log fields of a request.
+func withFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &ctxFields{fields: fields})
+}
+
+// contextFields returns a copy of the log fields held by the context.
+func contextFields(ctx context.Context) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if holder, ok := ctx.Value(ctxKey{}).(*ctxFields); ok {
+		holder.mux.Lock()
+		for k, v := range holder.fields {
+			fields[k] = v
+		}
+		holder.mux.Unlock()
+	}
+	return fields
+}
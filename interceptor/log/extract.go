@@ -0,0 +1,58 @@
+package log
+
+import (
+	"sync"
+
+	"github.com/bdlm/log"
+	"google.golang.org/grpc"
+)
+
+// extractFields returns the fields FieldExtractor extracts from a request
+// message, or nil if it isn't set. A panicking extractor is logged and
+// yields no fields instead of failing the request.
+func (li *Interceptor) extractFields(fullMethod string, req interface{}) (fields map[string]interface{}) {
+	if nil == li.FieldExtractor {
+		return nil
+	}
+	defer func() {
+		if r := recover(); nil != r {
+			li.logger().WithFields(log.Fields{
+				"gateway-method": fullMethod,
+				"panic":          r,
+			}).Error("log field extractor panicked")
+			fields = nil
+		}
+	}()
+	return li.FieldExtractor(fullMethod, req)
+}
+
+// extracting returns stream wrapped to add the fields extracted from the
+// first received message to the response log entry, or stream itself if no
+// FieldExtractor is set.
+func (li *Interceptor) extracting(stream grpc.ServerStream, fullMethod string) grpc.ServerStream {
+	if nil == li.FieldExtractor {
+		return stream
+	}
+	return &extractingServerStream{ServerStream: stream, fullMethod: fullMethod, li: li}
+}
+
+// extractingServerStream wraps a ServerStream in order to extract log fields
+// from the first received message.
+type extractingServerStream struct {
+	grpc.ServerStream
+	fullMethod string
+	li         *Interceptor
+	once       sync.Once
+}
+
+// RecvMsg lets extractingServerStream implement ServerStream, and will
+// extract log fields from the first received message.
+func (e *extractingServerStream) RecvMsg(m interface{}) error {
+	err := e.ServerStream.RecvMsg(m)
+	if nil == err {
+		e.once.Do(func() {
+			AddFields(e.Context(), e.li.extractFields(e.fullMethod, m))
+		})
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package log
+
+import (
+	"context"
+	"os"
+)
+
+// AddFields adds fields to the response log entry of the request handled
+// with ctx, e.g. a resolved user ID, from a handler or an interceptor running
+// inside the Interceptor. It is safe for concurrent use, e.g. from goroutines
+// serving a stream, and does nothing if the request isn't logged by an
+// Interceptor.
+func AddFields(ctx context.Context, fields map[string]interface{}) {
+	holder, ok := ctx.Value(ctxKey{}).(*ctxFields)
+	if !ok {
+		return
+	}
+	holder.mux.Lock()
+	defer holder.mux.Unlock()
+	for k, v := range fields {
+		holder.fields[k] = v
+	}
+}
+
+// EnvFields returns log fields read from environment variables, for use as
+// Interceptor.BaseFields. vars maps field names to environment variable
+// names, e.g. {"region": "REGION", "pod": "POD_NAME"}. Unset variables are
+// omitted.
+func EnvFields(vars map[string]string) map[string]interface{} {
+	fields := make(map[string]interface{}, len(vars))
+	for field, name := range vars {
+		if value, ok := os.LookupEnv(name); ok {
+			fields[field] = value
+		}
+	}
+	return fields
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bdlm/log"
@@ -14,21 +15,57 @@ import (
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"crypto/sha1"
-	"encoding/base64"
 )
 
 // Interceptor contains gRPC interceptor middleware methods that logs the
 // request as it comes in and the response as it goes out.
 type Interceptor struct {
-	LogStreamRecvMsg bool // LogStreamRecvMsg if true will log out the contents of each received stream message
-	LogStreamSendMsg bool // LogStreamSendMsg if true will log out the contents of each sent stream message
-	LogUnaryReqMsg   bool // LogUnaryReqMsg if true will log out the contents of the request message/argument/parameters
+	BaseFields       map[string]interface{} // BaseFields are added to every log entry, e.g. service name or region; all other fields take precedence
+	CancelPolicy     CancelPolicy           // CancelPolicy defines how responses to requests cancelled by the client are logged
+	CollapseMetadata bool                   // CollapseMetadata if true will log single-valued metadata as a string instead of a list
+	ErrorLogInterval time.Duration          // ErrorLogInterval if non-zero will log identical errors (same method, code and message) at most once per interval
+	LogErrorDetails  bool                   // LogErrorDetails if true will log out the details attached to error statuses
+	LogStreamRecvMsg bool                   // LogStreamRecvMsg if true will log out the contents of each received stream message
+	LogStreamSendMsg bool                   // LogStreamSendMsg if true will log out the contents of each sent stream message
+	LogUnaryReqMsg   bool                   // LogUnaryReqMsg if true will log out the contents of the request message/argument/parameters
+	Logger           Logger                 // Logger if set will be logged to instead of the global logger
+	MaxPayloadBytes  int                    // MaxPayloadBytes if greater than zero will truncate logged messages larger than this many bytes of JSON
+	MetadataPrefix   string                 // MetadataPrefix if set will be prepended to the log field names of forwarded headers/metadata, e.g. "hdr."
+	NestMetadata     bool                   // NestMetadata if true will log forwarded headers/metadata in a single "metadata" field instead of top-level fields
+	RedactHeaders    []string               // RedactHeaders lists metadata keys (case-insensitive) whose values are logged as "[REDACTED]"; DefaultRedactHeaders if nil
+	SampleRate       float64                // SampleRate if between 0 and 1 will log only this fraction of successful requests, otherwise all requests are logged
+	SingleLine       bool                   // SingleLine if true will suppress the request log line and log the request fields with the response instead
+
+	StreamLogBatchSize     int           // StreamLogBatchSize if greater than 1 will buffer stream message log entries and write each batch of this size as a single "stream messages" entry, with the messages and the time each was sent or received in its messages field
+	StreamLogFlushInterval time.Duration // StreamLogFlushInterval if non-zero will write buffered stream message log entries at least this often
+	StreamLogSampleEvery   int           // StreamLogSampleEvery if greater than 1 will log only the first of every this many sent and received stream messages; failed sends and receives are always logged
+
+	SkipMethods       []string           // SkipMethods lists full method names ("/package.Service/Method") excluded from logging entirely, e.g. health probes
+	MethodSampleRates map[string]float64 // MethodSampleRates maps full method names ("/package.Service/Method") to their sample rate between 0 (never) and 1 (always), overriding SampleRate
+
+	CodeToLevel    func(codes.Code) std.Level                                      // CodeToLevel if set will map response codes to log levels instead of DefaultCodeToLevel
+	FieldExtractor func(fullMethod string, req interface{}) map[string]interface{} // FieldExtractor if set will add the fields it returns for the request message, or the first message of a client stream, e.g. a tenant ID
+	RequestIDFunc  func(ctx context.Context, md metadata.MD) string                // RequestIDFunc if set will generate the ID of requests without x-request-id metadata instead of hashing the user-agent and x-forwarded-for metadata
+	Sampler        func(ctx context.Context, fullMethod string) bool               // Sampler if set will decide which requests are sampled instead of SampleRate and MethodSampleRates
+	ShouldLog      func(fullMethod string) bool                                    // ShouldLog if set will exclude the methods it returns false for from logging entirely
+
+	errMux  sync.Mutex
+	errSeen map[string]*errorState
+}
+
+// errorState tracks repeated occurrences of an identical error log line.
+type errorState struct {
+	fields     map[string]interface{} // fields describing the error, for the suppressed count
+	level      std.Level
+	logged     time.Time
+	suppressed int64
 }
 
 // UnaryInterceptor is a grpc interceptor middleware that logs out the request
@@ -39,31 +76,47 @@ func (li *Interceptor) UnaryInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
+	if li.skipped(info.FullMethod) {
+		return handler(ctx, req)
+	}
 	start := time.Now()
 
 	// Base fields
-	fields := map[string]interface{}{
-		"gateway-service": path.Dir(info.FullMethod)[1:],
-		"gateway-method":  path.Base(info.FullMethod),
+	fields := li.baseFields(info.FullMethod)
+	ctx = li.withRequestID(ctx, fields)
+	for k, v := range li.extractFields(info.FullMethod, req) {
+		fields[k] = v
+	}
+
+	// Only log errors for requests that are not sampled
+	if !li.sampled(ctx, info.FullMethod) {
+		ctx = withFields(ctx, fields)
+		resp, err := handler(ctx, req)
+		if li.logUnsampled(err) {
+			li.logResponse(ctx, info.FullMethod, start, err, true, "response (unary)")
+		}
+		return resp, err
 	}
 
 	// Request Payload Value
 	if li.LogUnaryReqMsg {
 		if pb, ok := req.(proto.Message); ok {
-			fields["gateway-request"] = pb
+			for k, v := range payloadFields("gateway-request", pb, li.MaxPayloadBytes) {
+				fields[k] = v
+			}
 		}
 	}
 
 	// Add other fields and log the request started
-	logRequest(ctx, fields, "request (unary)")
+	li.logRequest(ctx, fields, "request (unary)")
 
 	// Call the handler
-	ctx = context.WithValue(ctx, ctxKey{}, fields)
+	ctx = withFields(ctx, fields)
 	resp, err := handler(ctx, req)
 
 	// Calculate elapsed time and log the response
 	// Re-extract the log fields, as they may have changed
-	logResponse(ctx, start, err, "response (unary)")
+	li.logResponse(ctx, info.FullMethod, start, err, true, "response (unary)")
 
 	// Return the response and error
 	return resp, err
@@ -77,6 +130,9 @@ func (li *Interceptor) StreamInterceptor(
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
+	if li.skipped(info.FullMethod) {
+		return handler(srv, stream)
+	}
 	start := time.Now()
 
 	// Get the wrapped server stream in order to access any modified context
@@ -85,53 +141,84 @@ func (li *Interceptor) StreamInterceptor(
 	ctx := wrapped.Context()
 
 	// Base fields
-	fields := map[string]interface{}{
-		"service": path.Dir(info.FullMethod)[1:],
-		"method":  path.Base(info.FullMethod),
+	fields := li.baseFields(info.FullMethod)
+	ctx = li.withRequestID(ctx, fields)
+
+	// Only log errors for requests that are not sampled
+	if !li.sampled(ctx, info.FullMethod) {
+		wrapped.WrappedContext = withFields(ctx, fields)
+		err := handler(srv, li.extracting(wrapped, info.FullMethod))
+		if li.logUnsampled(err) {
+			li.logResponse(wrapped.Context(), info.FullMethod, start, err, false, "response (stream)")
+		}
+		return err
 	}
 
 	// Grap a log entry with just the base fields, for each streaming
 	// send/receive
-	streamEntry := log.WithFields(log.Fields(fields))
+	streamEntry := li.logger().WithFields(log.Fields(fields))
 
 	// Add other fields and log the request started
-	logRequest(ctx, fields, "request (stream)")
-	wrapped.WrappedContext = context.WithValue(ctx, ctxKey{}, fields)
-
-	// Call the handler
-	err := handler(srv, &loggingServerStream{ServerStream: wrapped, entry: streamEntry, li: li})
+	li.logRequest(ctx, fields, "request (stream)")
+	wrapped.WrappedContext = withFields(ctx, fields)
+
+	// Call the handler, and write any buffered stream logs before the
+	// response is logged, or if the handler panics
+	loggingStream := &loggingServerStream{ServerStream: li.extracting(wrapped, info.FullMethod), entry: streamEntry, li: li, start: start}
+	defer loggingStream.flush()
+	err := handler(srv, loggingStream)
+	loggingStream.flush()
+	if ttfb := loggingStream.ttfb; ttfb > 0 {
+		AddFields(wrapped.Context(), map[string]interface{}{"ttfb": ttfb.Nanoseconds()})
+	}
 
 	// Calculate elapsed time and log the response
 	// Re-extract the log fields, as they may have changed
-	logResponse(wrapped.Context(), start, err, "response (stream)")
+	li.logResponse(wrapped.Context(), info.FullMethod, start, err, false, "response (stream)")
 
 	// Return the error
 	return err
 }
 
-// logRequest adds additional log fields for the peer address and metadata,
-// and then will log out the request access at info level.
-func logRequest(ctx context.Context, fields map[string]interface{}, msg string) {
+// baseFields returns the fields every log entry of a request starts with.
+func (li *Interceptor) baseFields(fullMethod string) map[string]interface{} {
+	fields := make(map[string]interface{}, len(li.BaseFields)+2)
+	for k, v := range li.BaseFields {
+		fields[k] = v
+	}
+	fields["gateway-service"] = path.Dir(fullMethod)[1:]
+	fields["gateway-method"] = path.Base(fullMethod)
+	return fields
+}
 
-	// metadata and headers.
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		for k, v := range md {
-			fields[k] = v
-		}
+// reservedFields are the log fields set by the interceptor outside of the
+// base fields. Metadata keys never overwrite these or the base fields.
+var reservedFields = map[string]bool{
+	":request-id":   true,
+	"cancelled":     true,
+	"code":          true,
+	"elapsed":       true,
+	"error-details": true,
+	"error-message": true,
+	"http-status":   true,
+	"messages":      true,
+	"metadata":      true,
+	"payload-bytes": true,
+	"peer":          true,
+	"span-id":       true,
+	"start":         true,
+	"suppressed":    true,
+	"tls-cipher":    true,
+	"tls-version":   true,
+	"trace-id":      true,
+	"truncated":     true,
+	"ttfb":          true,
+}
 
-		requestID := ""
-		if v, ok := fields["user-agent"]; ok {
-			requestID = fmt.Sprintf("%s%s", requestID, v)
-		}
-		if v, ok := fields["x-forwarded-for"]; ok {
-			requestID = fmt.Sprintf("%s%s", requestID, v)
-		}
-		if "" != requestID {
-			hash := sha1.New()
-			hash.Write([]byte(requestID))
-			fields[":request-id"] = base64.URLEncoding.EncodeToString(hash.Sum(nil))
-		}
-	}
+// logRequest adds additional log fields for the peer address and metadata,
+// and then will log out the request access at info level. In SingleLine mode
+// the fields are only collected, to be logged with the response.
+func (li *Interceptor) logRequest(ctx context.Context, fields map[string]interface{}, msg string) {
 
 	// peer address
 	if peerAddr, ok := peer.FromContext(ctx); ok {
@@ -148,28 +235,91 @@ func logRequest(ctx context.Context, fields map[string]interface{}, msg string)
 			)
 			fields["peer"] = address
 		}
+
+		// negotiated TLS parameters, when the server uses TLS credentials.
+		if tlsInfo, ok := peerAddr.AuthInfo.(credentials.TLSInfo); ok {
+			for k, v := range TLSFields(&tlsInfo.State) {
+				fields[k] = v
+			}
+		}
+	}
+
+	// metadata and headers.
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		// correlate with distributed traces when a trace context is
+		// propagated.
+		for k, v := range traceFields(md) {
+			fields[k] = v
+		}
+
+		// metadata fields never clobber the interceptor's own fields; a
+		// colliding key without a configured prefix is logged under
+		// "metadata-<key>" instead, unless all metadata is nested under a
+		// single field.
+		nested := map[string]interface{}{}
+		for k, v := range md {
+			var value interface{} = v
+			switch {
+			case li.redacted(k):
+				value = Redacted
+			case li.CollapseMetadata && 1 == len(v):
+				value = v[0]
+			}
+			if li.NestMetadata {
+				nested[k] = value
+				continue
+			}
+			key := li.MetadataPrefix + k
+			if _, ok := fields[key]; ok || reservedFields[key] {
+				key = "metadata-" + key
+			}
+			fields[key] = value
+		}
+		if li.NestMetadata && 0 < len(nested) {
+			fields["metadata"] = nested
+		}
 	}
 
-	log.WithFields(log.Fields(fields)).Info(msg)
+	if li.SingleLine {
+		return
+	}
+	li.logger().WithFields(log.Fields(fields)).Info(msg)
+}
+
+// DefaultRedactHeaders are the metadata keys redacted from the request log
+// when the interceptor's RedactHeaders is nil.
+var DefaultRedactHeaders = []string{"authorization", "cookie", "set-cookie"}
+
+// Redacted is logged in place of redacted metadata values.
+const Redacted = "[REDACTED]"
+
+// redacted reports whether the values of a metadata key must be redacted.
+// Headers the gateway forwards with the "grpcgateway-" prefix, such as
+// cookies, are matched by their header name.
+func (li *Interceptor) redacted(key string) bool {
+	headers := li.RedactHeaders
+	if nil == headers {
+		headers = DefaultRedactHeaders
+	}
+	for _, header := range headers {
+		if strings.EqualFold(header, key) || strings.EqualFold("grpcgateway-"+header, key) {
+			return true
+		}
+	}
+	return false
 }
 
 // marshaller is the marshaller used for serializing protobuf messages.
 var marshaller = &jsonpb.Marshaler{
 	EmitDefaults: true,
-	OrigName: true,
+	OrigName:     true,
 }
 
-// ctxKey is the key to use to lookup the logging fields map in the context.
-type ctxKey struct{}
-
 // logResponse calculates the elapsed time and the status code, and then
-// will log out the response has finished at an appropriate level.
-func logResponse(ctx context.Context, start time.Time, err error, msg string) {
-	var fields map[string]interface{}
-	var ok bool
-	if fields, ok = ctx.Value(ctxKey{}).(map[string]interface{}); !ok {
-		fields = map[string]interface{}{}
-	}
+// will log out the response has finished at an appropriate level. Unary
+// responses also log the "http-status" the gateway maps the code to.
+func (li *Interceptor) logResponse(ctx context.Context, fullMethod string, start time.Time, err error, unary bool, msg string) {
+	fields := contextFields(ctx)
 
 	// Calculate the elapsed time
 	fields["elapsed"] = time.Since(start).Nanoseconds()
@@ -178,9 +328,126 @@ func logResponse(ctx context.Context, start time.Time, err error, msg string) {
 	// Response code
 	code := status.Code(err)
 	fields["code"] = code
+	if unary {
+		// the status the gateway returns to REST clients; a stream's status
+		// is sent after its response has started.
+		fields["http-status"] = runtime.HTTPStatusFromCode(code)
+	}
+	for k, v := range li.errorFields(err) {
+		fields[k] = v
+	}
+
+	// Client cancellations
+	level := li.level(code)
+	if nil != err && context.Canceled == ctx.Err() {
+		switch li.CancelPolicy {
+		case CancelSuppress:
+			return
+		case CancelDebug:
+			level = log.DebugLevel
+			fallthrough
+		case CancelMark:
+			fields["cancelled"] = true
+			msg = "client cancelled"
+		}
+	}
+
+	// Rate-limit identical errors
+	if nil != err && li.ErrorLogInterval > 0 {
+		key := fullMethod + "\x00" + code.String() + "\x00" + status.Convert(err).Message()
+		summary := li.baseFields(fullMethod)
+		summary["code"] = code
+		summary["error-message"] = status.Convert(err).Message()
+		suppressed, ok := li.throttleError(key, summary, level)
+		if !ok {
+			return
+		}
+		if suppressed > 0 {
+			fields["suppressed"] = suppressed
+		}
+	}
 
 	// Log the response finished
-	levelLog(log.WithFields(log.Fields(fields)), DefaultCodeToLevel(code), msg)
+	levelLog(li.logger().WithFields(log.Fields(fields)), level, msg)
+}
+
+// errorFields returns the "error-message" field holding the status message
+// of an error response and, if LogErrorDetails is set, the "error-details"
+// field holding its status details. It returns nil for successful responses.
+func (li *Interceptor) errorFields(err error) map[string]interface{} {
+	if nil == err {
+		return nil
+	}
+	st := status.Convert(err)
+	fields := map[string]interface{}{"error-message": st.Message()}
+	if !li.LogErrorDetails {
+		return fields
+	}
+	details := []interface{}{}
+	for _, detail := range st.Details() {
+		if pb, ok := detail.(proto.Message); ok {
+			details = append(details, &jsonpbMarshaler{pb})
+		} else {
+			details = append(details, fmt.Sprint(detail))
+		}
+	}
+	if 0 < len(details) {
+		fields["error-details"] = details
+	}
+	return fields
+}
+
+// level returns the log level of a response code.
+func (li *Interceptor) level(code codes.Code) std.Level {
+	if nil != li.CodeToLevel {
+		return li.CodeToLevel(code)
+	}
+	return DefaultCodeToLevel(code)
+}
+
+// throttleError reports whether an error log line identified by key should be
+// logged, and how many identical lines were suppressed since it was last
+// logged. fields and level describe the error: once the interval has passed,
+// the suppressed count of errors that didn't recur is logged with them in an
+// "errors suppressed" entry, as the next line of any error prunes them.
+func (li *Interceptor) throttleError(key string, fields map[string]interface{}, level std.Level) (int64, bool) {
+	li.errMux.Lock()
+
+	now := time.Now()
+	if nil == li.errSeen {
+		li.errSeen = map[string]*errorState{}
+	}
+
+	state, ok := li.errSeen[key]
+	if ok && now.Sub(state.logged) < li.ErrorLogInterval {
+		state.suppressed++
+		li.errMux.Unlock()
+		return 0, false
+	}
+
+	var suppressed int64
+	if ok {
+		suppressed = state.suppressed
+	}
+
+	// prune expired entries so the map doesn't grow without bound, keeping
+	// the suppressed counts of other errors to report them.
+	expired := []*errorState{}
+	for k, v := range li.errSeen {
+		if now.Sub(v.logged) >= li.ErrorLogInterval {
+			if k != key && v.suppressed > 0 {
+				expired = append(expired, v)
+			}
+			delete(li.errSeen, k)
+		}
+	}
+	li.errSeen[key] = &errorState{fields: fields, level: level, logged: now}
+	li.errMux.Unlock()
+
+	for _, v := range expired {
+		levelLog(li.logger().WithFields(v.fields).WithField("suppressed", v.suppressed), v.level, "errors suppressed")
+	}
+	return suppressed, true
 }
 
 // jsonpbMarshaler lets a proto interface be marshalled into json
@@ -201,15 +468,27 @@ func (j *jsonpbMarshaler) MarshalJSON() ([]byte, error) {
 // receive.
 type loggingServerStream struct {
 	grpc.ServerStream
-	entry *log.Entry
+	entry Logger
 	li    *Interceptor
+	start time.Time
+	ttfb  time.Duration // time from the start of the request to the first sent message
+
+	recvCount int // received messages, for StreamLogSampleEvery
+	sendCount int // sent messages, for StreamLogSampleEvery
+
+	bufMux sync.Mutex
+	buf    []streamLogRecord
+	timer  *time.Timer
 }
 
 // SendMsg lets loggingServerStream implement ServerStream, and will log sends.
 func (l *loggingServerStream) SendMsg(m interface{}) error {
 	err := l.ServerStream.SendMsg(m)
-	if l.li.LogStreamSendMsg {
-		logProtoMessageAsJSON(l.entry, m, status.Code(err), "value", "StreamSend")
+	if 0 == l.ttfb {
+		l.ttfb = time.Since(l.start)
+	}
+	if l.li.LogStreamSendMsg && l.sampled(&l.sendCount, err) {
+		l.log(m, status.Code(err), "StreamSend")
 	}
 	return err
 }
@@ -218,36 +497,39 @@ func (l *loggingServerStream) SendMsg(m interface{}) error {
 // receives.
 func (l *loggingServerStream) RecvMsg(m interface{}) error {
 	err := l.ServerStream.RecvMsg(m)
-	if l.li.LogStreamRecvMsg {
-		logProtoMessageAsJSON(l.entry, m, status.Code(err), "value", "StreamRecv")
+	if l.li.LogStreamRecvMsg && l.sampled(&l.recvCount, err) {
+		l.log(m, status.Code(err), "StreamRecv")
 	}
 	return err
 }
 
-// logProtoMessageAsJSON logs an incoming or outgoing protobuf message as JSON.
-func logProtoMessageAsJSON(
-	entry *log.Entry,
+// logProtoMessageAsJSON logs an incoming or outgoing protobuf message as JSON,
+// truncated to MaxPayloadBytes if greater than zero, at the level of the code.
+func (li *Interceptor) logProtoMessageAsJSON(
+	entry Logger,
 	pbMsg interface{},
 	code codes.Code,
 	key string,
 	msg string,
 ) {
 	if p, ok := pbMsg.(proto.Message); ok {
-		levelLog(entry.WithFields(log.Fields{key: &jsonpbMarshaler{p}, "code": code}), DefaultCodeToLevel(code), msg)
+		fields := payloadFields(key, p, li.MaxPayloadBytes)
+		fields["code"] = code
+		levelLog(entry.WithFields(fields), li.level(code), msg)
 	} else {
-		levelLog(entry.WithField("code", code), DefaultCodeToLevel(code), msg)
+		levelLog(entry.WithField("code", code), li.level(code), msg)
 	}
 }
 
 // levelLog logs an entry and message at the appropriate levell
-func levelLog(entry *log.Entry, level std.Level, msg string) {
+func levelLog(entry Logger, level std.Level, msg string) {
 	switch level {
 	case log.DebugLevel:
 		entry.Debug(msg)
 	case log.InfoLevel:
 		entry.Info(msg)
 	case log.WarnLevel:
-		entry.Warning(msg)
+		entry.Warn(msg)
 	case log.ErrorLevel:
 		entry.Error(msg)
 	case log.FatalLevel:
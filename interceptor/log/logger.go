@@ -0,0 +1,72 @@
+package log
+
+import "github.com/bdlm/log"
+
+// Logger is a structured logger. The interceptors, gateway helpers and server
+// log to a Logger if one is set, and to the global logger otherwise. Loggers
+// of github.com/bdlm/log are adapted with NewLogger.
+type Logger interface {
+	WithError(err error) Logger
+	WithField(key string, value interface{}) Logger
+	WithFields(fields map[string]interface{}) Logger
+
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+	Fatal(args ...interface{})
+	Panic(args ...interface{})
+}
+
+// NewLogger returns a Logger writing to logger, or to the global logger if it
+// is nil.
+func NewLogger(logger *log.Logger) Logger {
+	if nil != logger {
+		return &entryLogger{Entry: logger.WithFields(log.Fields{}), logger: logger}
+	}
+	return &entryLogger{Entry: log.WithFields(log.Fields{})}
+}
+
+// entryLogger adapts a log entry to the Logger interface.
+type entryLogger struct {
+	*log.Entry
+	logger *log.Logger // the logger of the entry, nil for the global logger
+}
+
+// WithError implements Logger.
+func (l *entryLogger) WithError(err error) Logger {
+	return &entryLogger{Entry: l.Entry.WithError(err), logger: l.logger}
+}
+
+// WithField implements Logger.
+func (l *entryLogger) WithField(key string, value interface{}) Logger {
+	return &entryLogger{Entry: l.Entry.WithField(key, value), logger: l.logger}
+}
+
+// WithFields implements Logger.
+func (l *entryLogger) WithFields(fields map[string]interface{}) Logger {
+	return &entryLogger{Entry: l.Entry.WithFields(log.Fields(fields)), logger: l.logger}
+}
+
+// addHook adds a hook to the logger of the entry.
+func (l *entryLogger) addHook(hook *AlertHook) {
+	if nil != l.logger {
+		l.logger.AddHook(hook)
+		return
+	}
+	log.AddHook(hook)
+}
+
+// loggerOrDefault returns logger, or the global logger if it is nil.
+func loggerOrDefault(logger Logger) Logger {
+	if nil != logger {
+		return logger
+	}
+	return NewLogger(nil)
+}
+
+// logger returns the interceptor Logger, or the global logger if it isn't
+// set.
+func (li *Interceptor) logger() Logger {
+	return loggerOrDefault(li.Logger)
+}
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"sort"
+)
+
+// DefaultFieldOrder are the log fields a FieldSorter places first if its
+// Order is nil.
+var DefaultFieldOrder = []string{
+	"gateway-service",
+	"gateway-method",
+	"code",
+	"elapsed",
+	":request-id",
+}
+
+// FieldSorter sorts log field keys: the fields listed in Order first, in that
+// order, followed by all other fields. Its Sort method can be used as the
+// sorting function of a text formatter so that log lines render their keys in
+// a stable order:
+//
+//	sorter := &log_interceptor.FieldSorter{SortRemaining: true}
+//	log.SetFormatter(&log.TextFormatter{SortingFunc: sorter.Sort})
+type FieldSorter struct {
+	Order         []string // Order lists the fields placed first, in order, including formatter keys such as the timestamp, level and message; DefaultFieldOrder if nil
+	SortRemaining bool     // SortRemaining if true will sort the fields not listed in Order alphabetically instead of keeping the order they were passed in, which for log fields is map iteration order
+}
+
+// Sort sorts log field keys in place.
+func (s *FieldSorter) Sort(keys []string) {
+	order := s.Order
+	if nil == order {
+		order = DefaultFieldOrder
+	}
+	rank := make(map[string]int, len(order))
+	for k, field := range order {
+		if _, ok := rank[field]; !ok {
+			rank[field] = k
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		ri, iok := rank[keys[i]]
+		rj, jok := rank[keys[j]]
+		switch {
+		case iok && jok:
+			return ri < rj
+		case iok != jok:
+			return iok
+		case s.SortRemaining:
+			return keys[i] < keys[j]
+		}
+		return false
+	})
+}
+
+// SortFields sorts log field keys in place: the fields listed in
+// DefaultFieldOrder first, in that order, followed by all other fields sorted
+// alphabetically.
+//
+//	log.SetFormatter(&log.TextFormatter{SortingFunc: log_interceptor.SortFields})
+func SortFields(keys []string) {
+	(&FieldSorter{SortRemaining: true}).Sort(keys)
+}
@@ -0,0 +1,39 @@
+package log
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/bdlm/log"
+	"github.com/golang/protobuf/proto"
+)
+
+// payloadFields returns the log fields for a message logged under key. If
+// max is greater than zero and the JSON encoded message is larger, the
+// encoding is truncated to max bytes and logged as a string, along with
+// "truncated" and the original size in "payload-bytes". Otherwise the message
+// is encoded when the entry is written.
+func payloadFields(key string, pb proto.Message, max int) log.Fields {
+	if max <= 0 {
+		return log.Fields{key: &jsonpbMarshaler{pb}}
+	}
+
+	data, err := (&jsonpbMarshaler{pb}).MarshalJSON()
+	if nil != err {
+		return log.Fields{key: err.Error()}
+	}
+	if len(data) <= max {
+		return log.Fields{key: json.RawMessage(data)}
+	}
+
+	// don't split a multi-byte character.
+	end := max
+	for end > 0 && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	return log.Fields{
+		key:             string(data[:end]),
+		"payload-bytes": len(data),
+		"truncated":     true,
+	}
+}
@@ -0,0 +1,73 @@
+package log
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDKey is the metadata key of a request ID provided by the client or
+// an upstream proxy.
+const RequestIDKey = "x-request-id"
+
+// requestIDKey is the key to use to lookup the request ID in the context.
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request handled with ctx, as logged in the
+// ":request-id" field, or "" if the request has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID determines the request ID and adds it to the log fields and
+// the context, to the outgoing metadata so it is propagated to the backend
+// services the handler calls, and to the response header metadata so the
+// gateway can return it to REST clients. The ID is taken from the x-request-id
+// metadata, generated with RequestIDFunc, or, if neither is available and
+// the request carries no trace context, synthesized from the user-agent and
+// x-forwarded-for metadata.
+func (li *Interceptor) withRequestID(ctx context.Context, fields map[string]interface{}) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := ""
+	if values := md.Get(RequestIDKey); 0 < len(values) && "" != values[0] {
+		id = values[0]
+	} else if nil != li.RequestIDFunc {
+		id = li.RequestIDFunc(ctx, md)
+	} else if nil == traceFields(md) {
+		id = hashRequestID(md)
+	}
+	if "" == id {
+		return ctx
+	}
+
+	fields[":request-id"] = id
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id)); nil != err {
+		li.logger().WithField("error-message", err.Error()).Debug("could not set the request ID response header")
+	}
+	return metadata.AppendToOutgoingContext(ctx, RequestIDKey, id)
+}
+
+// hashRequestID returns a request ID hashed from the user-agent and
+// x-forwarded-for metadata, or "" if neither is set.
+func hashRequestID(md metadata.MD) string {
+	requestID := ""
+	if v, ok := md["user-agent"]; ok {
+		requestID = fmt.Sprintf("%s%s", requestID, v)
+	}
+	if v, ok := md["x-forwarded-for"]; ok {
+		requestID = fmt.Sprintf("%s%s", requestID, v)
+	}
+	if "" == requestID {
+		return ""
+	}
+	hash := sha1.New()
+	hash.Write([]byte(requestID))
+	return base64.URLEncoding.EncodeToString(hash.Sum(nil))
+}
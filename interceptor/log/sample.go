@@ -0,0 +1,68 @@
+package log
+
+import (
+	"context"
+	"io"
+	"math/rand"
+
+	"github.com/bdlm/log"
+	"google.golang.org/grpc/status"
+)
+
+// sampled reports whether a request to a method is logged. The decision is
+// made before anything is extracted from the request. Unsampled requests are
+// only logged if they fail with a code logged at warn level or above.
+func (li *Interceptor) sampled(ctx context.Context, fullMethod string) bool {
+	if nil != li.Sampler {
+		return li.Sampler(ctx, fullMethod)
+	}
+	rate, ok := li.MethodSampleRates[fullMethod]
+	if !ok {
+		if li.SampleRate <= 0 {
+			return true
+		}
+		rate = li.SampleRate
+	}
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	return rand.Float64() < rate
+}
+
+// logUnsampled reports whether the response of an unsampled request is
+// logged: only errors logged at warn level or above are.
+func (li *Interceptor) logUnsampled(err error) bool {
+	return nil != err && li.level(status.Code(err)) <= log.WarnLevel
+}
+
+// skipped reports whether a method is excluded from logging entirely, even
+// when a request fails.
+func (li *Interceptor) skipped(fullMethod string) bool {
+	for _, method := range li.SkipMethods {
+		if method == fullMethod {
+			return true
+		}
+	}
+	return nil != li.ShouldLog && !li.ShouldLog(fullMethod)
+}
+
+// sampled counts a sent or received stream message and reports whether it is
+// logged: the first of every StreamLogSampleEvery messages, and every
+// failure. The end of a client stream (io.EOF) is not a failure. Sends and
+// receives are counted separately, as each may only be called from a single
+// goroutine.
+func (l *loggingServerStream) sampled(count *int, err error) bool {
+	every := l.li.StreamLogSampleEvery
+	if every <= 1 {
+		return true
+	}
+	n := *count
+	*count++
+	if nil != err && io.EOF != err {
+		return true
+	}
+	return 0 == n%every
+}
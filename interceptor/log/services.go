@@ -0,0 +1,71 @@
+package log
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bdlm/log"
+	"google.golang.org/grpc"
+)
+
+// LogServices logs a structured summary of every method registered on the
+// gRPC server to logger, or to the global logger if it is nil: the service
+// and method names, the streaming type and the deadline policy. It should be
+// called once at startup, after all services have been registered, to
+// provide an inventory of the exposed surface.
+//
+// deadlines maps full method names ("/package.Service/Method") to the deadline
+// enforced for that method. The "" key, if present, is used as the default
+// for methods without an entry. Methods without a deadline are logged with a
+// deadline of "none".
+func LogServices(logger Logger, srv *grpc.Server, deadlines map[string]time.Duration) {
+	logger = loggerOrDefault(logger)
+	info := srv.GetServiceInfo()
+
+	services := make([]string, 0, len(info))
+	for service := range info {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		methods := info[service].Methods
+		sort.Slice(methods, func(i, j int) bool {
+			return methods[i].Name < methods[j].Name
+		})
+
+		for _, method := range methods {
+			fields := log.Fields{
+				"gateway-service": service,
+				"gateway-method":  method.Name,
+				"streaming":       streamingType(method),
+				"deadline":        "none",
+			}
+			if file, ok := info[service].Metadata.(string); ok && "" != file {
+				fields["proto-file"] = file
+			}
+			deadline, ok := deadlines["/"+service+"/"+method.Name]
+			if !ok {
+				deadline, ok = deadlines[""]
+			}
+			if ok && deadline > 0 {
+				fields["deadline"] = deadline.String()
+			}
+			logger.WithFields(fields).Info("method registered")
+		}
+	}
+}
+
+// streamingType returns the streaming type of a method as a string.
+func streamingType(method grpc.MethodInfo) string {
+	switch {
+	case method.IsClientStream && method.IsServerStream:
+		return "bidi-stream"
+	case method.IsClientStream:
+		return "client-stream"
+	case method.IsServerStream:
+		return "server-stream"
+	default:
+		return "unary"
+	}
+}
@@ -0,0 +1,44 @@
+package log
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// TraceParentKey is the metadata key of the W3C Trace Context header, as
+// propagated by OpenTelemetry and other tracing clients. REST requests only
+// carry it if the gateway is configured to forward the traceparent header.
+const TraceParentKey = "traceparent"
+
+// traceFields returns the "trace-id" and "span-id" log fields of the W3C
+// traceparent in the request metadata, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", or nil if there
+// is no valid trace context.
+func traceFields(md metadata.MD) map[string]interface{} {
+	values := md.Get(TraceParentKey)
+	if 0 == len(values) {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSpace(values[0]), "-")
+	if len(parts) < 4 || "ff" == parts[0] || !isHexID(parts[0], 2) || !isHexID(parts[1], 32) || !isHexID(parts[2], 16) {
+		return nil
+	}
+	return map[string]interface{}{
+		"span-id":  parts[2],
+		"trace-id": parts[1],
+	}
+}
+
+// isHexID reports whether id is a lowercase hex string of the given length
+// that isn't all zeros, which the W3C specification defines as invalid.
+func isHexID(id string, length int) bool {
+	if len(id) != length || strings.ToLower(id) != id {
+		return false
+	}
+	if _, err := hex.DecodeString(id); nil != err {
+		return false
+	}
+	return 2 == length || strings.Trim(id, "0") != ""
+}
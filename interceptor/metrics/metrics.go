@@ -0,0 +1,170 @@
+// Package metrics contains interceptor/middleware helpers for Prometheus
+// metrics.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// Interceptor contains gRPC interceptor middleware methods that record RPC
+// counters, latency histograms and in-flight gauges, labelled by service,
+// method, RPC type and, once handled, status code. Label values are the same
+// as the log interceptor "gateway-service" and "gateway-method" fields.
+//
+// The metrics are registered on first use.
+type Interceptor struct {
+	Buckets    []float64              // Buckets if set will be used for the latency histogram instead of prometheus.DefBuckets
+	Logger     log_interceptor.Logger // Logger if set will be logged to instead of the global logger
+	Namespace  string                 // Namespace if set will be prepended to the metric names, e.g. "myapp_grpc_server_handled_total"
+	Registerer prometheus.Registerer  // Registerer if set will register the metrics instead of prometheus.DefaultRegisterer
+
+	once     sync.Once
+	handled  *prometheus.CounterVec
+	inFlight *prometheus.GaugeVec
+	latency  *prometheus.HistogramVec
+	started  *prometheus.CounterVec
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that records metrics for
+// unary RPCs.
+func (mi *Interceptor) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	done := mi.start(info.FullMethod, "unary")
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+// StreamInterceptor is a grpc interceptor middleware that records metrics for
+// streaming RPCs.
+func (mi *Interceptor) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	rpcType := "bidi_stream"
+	switch {
+	case info.IsClientStream && !info.IsServerStream:
+		rpcType = "client_stream"
+	case !info.IsClientStream && info.IsServerStream:
+		rpcType = "server_stream"
+	}
+	done := mi.start(info.FullMethod, rpcType)
+	err := handler(srv, stream)
+	done(err)
+	return err
+}
+
+// Handler returns an HTTP handler exposing the metrics of the registry the
+// interceptor registers on, to be mounted on the router, e.g. with
+// router.Handle("/metrics", interceptor.Handler()). If Registerer isn't also
+// a prometheus.Gatherer, the default registry is exposed.
+func (mi *Interceptor) Handler() http.Handler {
+	if gatherer, ok := mi.Registerer.(prometheus.Gatherer); ok {
+		return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	}
+	return promhttp.Handler()
+}
+
+// start records the start of an RPC and returns the function recording its
+// completion.
+func (mi *Interceptor) start(fullMethod, rpcType string) func(err error) {
+	mi.once.Do(mi.register)
+
+	start := time.Now()
+	service, method := path.Dir(fullMethod)[1:], path.Base(fullMethod)
+	mi.started.WithLabelValues(service, method, rpcType).Inc()
+	inFlight := mi.inFlight.WithLabelValues(service, method, rpcType)
+	inFlight.Inc()
+
+	return func(err error) {
+		inFlight.Dec()
+		code := status.Code(err).String()
+		mi.handled.WithLabelValues(service, method, rpcType, code).Inc()
+		mi.latency.WithLabelValues(service, method, rpcType, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// register creates and registers the metrics. If identical metrics are
+// already registered, e.g. by another interceptor on the same registry, they
+// are shared.
+func (mi *Interceptor) register() {
+	registerer := mi.Registerer
+	if nil == registerer {
+		registerer = prometheus.DefaultRegisterer
+	}
+	logger := mi.logger()
+	buckets := mi.Buckets
+	if 0 == len(buckets) {
+		buckets = prometheus.DefBuckets
+	}
+	labels := []string{"grpc_service", "grpc_method", "grpc_type"}
+	codeLabels := append(labels, "grpc_code")
+
+	mi.started = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: mi.Namespace,
+		Name:      "grpc_server_started_total",
+		Help:      "Total number of RPCs started on the server.",
+	}, labels)
+	mi.handled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: mi.Namespace,
+		Name:      "grpc_server_handled_total",
+		Help:      "Total number of RPCs completed on the server, regardless of success or failure.",
+	}, codeLabels)
+	mi.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: mi.Namespace,
+		Name:      "grpc_server_in_flight",
+		Help:      "Number of RPCs currently being handled by the server.",
+	}, labels)
+	mi.latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: mi.Namespace,
+		Name:      "grpc_server_handling_seconds",
+		Help:      "Histogram of response latency of RPCs handled by the server.",
+		Buckets:   buckets,
+	}, codeLabels)
+
+	mi.started = register(logger, registerer, mi.started).(*prometheus.CounterVec)
+	mi.handled = register(logger, registerer, mi.handled).(*prometheus.CounterVec)
+	mi.inFlight = register(logger, registerer, mi.inFlight).(*prometheus.GaugeVec)
+	mi.latency = register(logger, registerer, mi.latency).(*prometheus.HistogramVec)
+}
+
+// logger returns the interceptor Logger, or the global logger if it isn't
+// set.
+func (mi *Interceptor) logger() log_interceptor.Logger {
+	if nil != mi.Logger {
+		return mi.Logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
+
+// register registers a collector, returning the already registered collector
+// if an identical one exists. Other registration errors are logged to logger
+// and the collector is used unregistered.
+func register(logger log_interceptor.Logger, registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	err := registerer.Register(collector)
+	if nil == err {
+		return collector
+	}
+	if registered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return registered.ExistingCollector
+	}
+	logger.WithError(err).Error("could not register metrics collector")
+	return collector
+}
@@ -0,0 +1,89 @@
+// Package stamp contains interceptor/middleware helpers for tagging requests
+// with the build and deployment that served them.
+package stamp
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// DeploymentKey is the response metadata key containing the deployment.
+const DeploymentKey = "x-deployment"
+
+// VersionKey is the response metadata key containing the build version.
+const VersionKey = "x-build-version"
+
+// Interceptor contains gRPC interceptor middleware methods that stamp each
+// response with the build version and deployment, so behavior can be
+// attributed to a specific rollout during canary analysis.
+//
+// The values are set as response header metadata, and added to the response
+// log entry as the "x-build-version" and "x-deployment" fields with
+// log_interceptor.AddFields, overriding any metadata of the same name sent by
+// the client; chain this interceptor after the log interceptor. The
+// grpc-gateway forwards the response metadata to REST clients as
+// "Grpc-Metadata-X-Build-Version" and "Grpc-Metadata-X-Deployment" headers.
+type Interceptor struct {
+	Deployment string // Deployment is the deployment name or color, e.g. "blue", omitted if empty
+	Version    string // Version is the build version, omitted if empty
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that stamps the response.
+func (si *Interceptor) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	md := si.stamp()
+	if len(md) > 0 {
+		if err := grpc.SetHeader(ctx, md); nil != err {
+			return nil, err
+		}
+		log_interceptor.AddFields(ctx, logFields(md))
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor is a grpc interceptor middleware that stamps the stream
+// response.
+func (si *Interceptor) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	md := si.stamp()
+	if len(md) > 0 {
+		if err := stream.SetHeader(md); nil != err {
+			return err
+		}
+		log_interceptor.AddFields(stream.Context(), logFields(md))
+	}
+	return handler(srv, stream)
+}
+
+// stamp returns the response metadata for the configured values.
+func (si *Interceptor) stamp() metadata.MD {
+	md := metadata.MD{}
+	if "" != si.Version {
+		md.Set(VersionKey, si.Version)
+	}
+	if "" != si.Deployment {
+		md.Set(DeploymentKey, si.Deployment)
+	}
+	return md
+}
+
+// logFields returns the log fields for the stamp metadata.
+func logFields(md metadata.MD) map[string]interface{} {
+	fields := make(map[string]interface{}, len(md))
+	for k, v := range md {
+		fields[k] = v[0]
+	}
+	return fields
+}
@@ -0,0 +1,85 @@
+package timeout
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Client contains gRPC client interceptor methods that set a deadline on
+// outbound calls, such as the calls from the gateway to the backend, so a
+// hung backend can't hold the caller indefinitely. A deadline already set on
+// the call context, e.g. from the inbound request, takes precedence if it is
+// earlier.
+type Client struct {
+	Default time.Duration            // Default is the deadline for methods without an entry in Methods, 0 for none
+	Methods map[string]time.Duration // Methods maps full method names ("/package.Service/Method") to their deadline, 0 for none
+}
+
+// UnaryClientInterceptor is a grpc client interceptor that sets the method's
+// deadline on unary calls.
+func (c *Client) UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	timeout := c.timeout(method)
+	if timeout <= 0 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// StreamClientInterceptor is a grpc client interceptor that sets the method's
+// deadline on streaming calls. The deadline applies to the whole stream.
+func (c *Client) StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	timeout := c.timeout(method)
+	if timeout <= 0 {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if nil != err {
+		cancel()
+		return nil, err
+	}
+	return &clientStream{ClientStream: stream, cancel: cancel}, nil
+}
+
+// timeout returns the deadline for a method.
+func (c *Client) timeout(method string) time.Duration {
+	if timeout, ok := c.Methods[method]; ok {
+		return timeout
+	}
+	return c.Default
+}
+
+// clientStream wraps a ClientStream in order to release the deadline timer
+// when the stream ends.
+type clientStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+// RecvMsg lets clientStream implement ClientStream, and will release the
+// deadline timer once the stream has ended.
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if nil != err {
+		s.cancel()
+	}
+	return err
+}
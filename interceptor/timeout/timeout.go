@@ -0,0 +1,124 @@
+// Package timeout contains interceptor/middleware helpers for enforcing
+// request deadlines.
+package timeout
+
+import (
+	"context"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultHeader is the metadata key read by the interceptor if no Header is
+// configured.
+const DefaultHeader = "x-request-timeout"
+
+// Interceptor contains gRPC interceptor middleware methods that apply a
+// client-requested timeout, read from the request metadata as a duration
+// string such as "2s" or "500ms", as the deadline of the handler context.
+//
+// Unary requests are also limited to a per-method server timeout, set with
+// Methods and Default, whichever of the two timeouts is shorter; streams,
+// which may run indefinitely, only apply the requested timeout. Handlers must
+// observe the context for the timeout to stop them.
+//
+// The grpc-gateway only forwards headers accepted by its header matcher; by
+// default REST clients must send the timeout as "Grpc-Metadata-X-Request-Timeout".
+type Interceptor struct {
+	Default time.Duration            // Default is the server timeout of unary methods without an entry in Methods, 0 for none
+	Header  string                   // Header is the metadata key containing the requested timeout, DefaultHeader if empty
+	Max     time.Duration            // Max caps the requested timeout, 0 for no cap
+	Methods map[string]time.Duration // Methods maps full method names ("/package.Service/Method") to their server timeout, 0 for none
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that applies the
+// requested timeout and the method's server timeout to the handler context.
+func (ti *Interceptor) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, cancel, err := ti.context(ctx)
+	if nil != err {
+		return nil, err
+	}
+	defer cancel()
+	if timeout := ti.timeout(info.FullMethod); timeout > 0 {
+		var cancelMethod context.CancelFunc
+		ctx, cancelMethod = context.WithTimeout(ctx, timeout)
+		defer cancelMethod()
+	}
+
+	resp, err := handler(ctx, req)
+	return resp, deadlineError(ctx, err)
+}
+
+// StreamInterceptor is a grpc interceptor middleware that applies the
+// requested timeout to the stream context.
+func (ti *Interceptor) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, cancel, err := ti.context(stream.Context())
+	if nil != err {
+		return err
+	}
+	defer cancel()
+
+	wrapped := grpc_middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = ctx
+	return deadlineError(ctx, handler(srv, wrapped))
+}
+
+// context returns a context with the requested timeout applied. Invalid
+// timeout values are rejected with an InvalidArgument error.
+func (ti *Interceptor) context(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	header := ti.Header
+	if "" == header {
+		header = DefaultHeader
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(header)
+	if 0 == len(values) || "" == values[0] {
+		return ctx, func() {}, nil
+	}
+
+	timeout, err := time.ParseDuration(values[0])
+	if nil != err || timeout <= 0 {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid %s value %q: expected a positive duration such as \"2s\"", header, values[0])
+	}
+	if ti.Max > 0 && timeout > ti.Max {
+		timeout = ti.Max
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// timeout returns the server timeout of a method.
+func (ti *Interceptor) timeout(fullMethod string) time.Duration {
+	if timeout, ok := ti.Methods[fullMethod]; ok {
+		return timeout
+	}
+	return ti.Default
+}
+
+// deadlineError returns a DeadlineExceeded error in place of a handler error
+// caused by the deadline expiring.
+func deadlineError(ctx context.Context, err error) error {
+	if nil == err || context.DeadlineExceeded != ctx.Err() {
+		return err
+	}
+	if codes.DeadlineExceeded == status.Code(err) {
+		return err
+	}
+	return status.Error(codes.DeadlineExceeded, "request timeout exceeded")
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bdlm/log"
+	chi_middleware "github.com/go-chi/chi/middleware"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// AccessLog is a middleware that logs every HTTP request once the response
+// has been written, including requests that never reach a gRPC handler (such
+// as router 404s). 5xx responses are logged at error level, everything else
+// at info level. The negotiated TLS version and cipher suite are logged for
+// TLS connections. The request ID set by the RequestID middleware is logged
+// as ":request-id", like the log interceptor does, to correlate the entry
+// with the gRPC log entries of the request.
+//
+// The request Content-Type and Accept headers and the response Content-Type
+// are logged as "content-type", "accept" and "response-content-type", which
+// identify the marshalers the gateway selected to decode the request and
+// encode the response.
+//
+// AccessLog logs to the global logger, see AccessLogTo.
+func AccessLog(next http.Handler) http.Handler {
+	return AccessLogTo(nil)(next)
+}
+
+// AccessLogTo returns an AccessLog middleware that logs to logger, or to the
+// global logger if it is nil.
+func AccessLogTo(logger log_interceptor.Logger) func(http.Handler) http.Handler {
+	if nil == logger {
+		logger = log_interceptor.NewLogger(nil)
+	}
+	return func(next http.Handler) http.Handler {
+		return accessLog(logger, next)
+	}
+}
+
+// accessLog returns a handler calling next and logging the request to logger.
+func accessLog(logger log_interceptor.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chi_middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if 0 == status {
+			status = http.StatusOK
+		}
+		fields := log.Fields{
+			"bytes":       ww.BytesWritten(),
+			"elapsed":     time.Since(start).Nanoseconds(),
+			"http-method": r.Method,
+			"http-status": status,
+			"path":        r.URL.Path,
+			"start":       start.Format(time.RFC3339Nano),
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); nil == err {
+			fields["peer"] = host
+		}
+		for field, value := range map[string]string{
+			":request-id":           r.Header.Get(RequestIDHeader),
+			"accept":                r.Header.Get("Accept"),
+			"content-type":          r.Header.Get("Content-Type"),
+			"response-content-type": ww.Header().Get("Content-Type"),
+		} {
+			if "" != value {
+				fields[field] = value
+			}
+		}
+		for k, v := range log_interceptor.TLSFields(r.TLS) {
+			fields[k] = v
+		}
+
+		entry := logger.WithFields(fields)
+		if status >= http.StatusInternalServerError {
+			entry.Error("request (http)")
+		} else {
+			entry.Info("request (http)")
+		}
+	})
+}
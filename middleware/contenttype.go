@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// RequireContentType returns a middleware that rejects requests carrying a
+// body whose Content-Type isn't one of the allowed media types, such as
+// "application/json", with a 415 Unsupported Media Type response. Without it
+// the gateway falls back to the wildcard marshaler for unknown or missing
+// content types, which can silently misparse the body.
+//
+// Media types are compared case-insensitively, ignoring parameters such as
+// charset. Requests without a body (a Content-Length of 0) are not checked.
+func RequireContentType(allowed ...string) func(http.Handler) http.Handler {
+	types := make(map[string]bool, len(allowed))
+	for _, contentType := range allowed {
+		if mediaType, _, err := mime.ParseMediaType(contentType); nil == err {
+			types[mediaType] = true
+		}
+	}
+	accepted := strings.Join(allowed, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if 0 == r.ContentLength {
+				next.ServeHTTP(w, r)
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if nil != err || !types[mediaType] {
+				w.Header().Set("Accept", accepted)
+				http.Error(
+					w,
+					fmt.Sprintf("%s: expected one of %s", http.StatusText(http.StatusUnsupportedMediaType), accepted),
+					http.StatusUnsupportedMediaType,
+				)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
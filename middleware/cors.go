@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"github.com/rs/cors"
+)
+
+// PreflightStatus defines the status code used to answer CORS preflight
+// requests.
+var PreflightStatus = http.StatusNoContent
+
+// CORS returns a middleware that applies the CORS policy c to all requests.
+//
+// Preflight requests (OPTIONS requests carrying an
+// Access-Control-Request-Method header) are answered directly with
+// PreflightStatus, regardless of the policy's OptionsPassthrough setting, so
+// they never reach the grpc-gateway multiplexer, where they would be answered
+// with a 405, and are never passed to any middleware mounted after this one,
+// such as an access logger.
+func CORS(c *cors.Cors) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handler := c.Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if http.MethodOptions == r.Method && "" != r.Header.Get("Access-Control-Request-Method") {
+				c.HandlerFunc(w, r)
+				w.WriteHeader(PreflightStatus)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// - process CORS configuration values out of environment variables
+func init() {
+	if err := envconfig.Process("", &CORSConf); nil != err {
+		panic(err)
+	}
+}
+
+// CORSConf contains the CORS configuration values read by CORSOptions.
+var CORSConf corsEnv
+
+// corsEnv defines the environment configuration for the CORS policy. Lists
+// are comma-separated.
+type corsEnv struct {
+	CorsAllowCredentials bool     `default:"false" split_words:"true"`                             // CORS_ALLOW_CREDENTIALS, allow cookies and authorization headers
+	CorsAllowedHeaders   []string `default:"Accept,Authorization,Content-Type" split_words:"true"` // CORS_ALLOWED_HEADERS
+	CorsAllowedMethods   []string `default:"GET,POST,PUT,PATCH,DELETE" split_words:"true"`         // CORS_ALLOWED_METHODS
+	CorsAllowedOrigins   []string `split_words:"true"`                                             // CORS_ALLOWED_ORIGINS, e.g. https://example.com, none by default
+	CorsExposedHeaders   []string `split_words:"true"`                                             // CORS_EXPOSED_HEADERS
+	CorsMaxAge           int      `default:"600" split_words:"true"`                               // CORS_MAX_AGE, seconds browsers may cache preflight results
+}
+
+// CORSOptions returns the CORS policy options configured by the CORS_*
+// environment variables. No cross-origin requests are allowed unless
+// CORS_ALLOWED_ORIGINS is set; "*" must be set explicitly to allow all
+// origins.
+func CORSOptions() (cors.Options, error) {
+	opts := cors.Options{
+		AllowCredentials: CORSConf.CorsAllowCredentials,
+		AllowedHeaders:   CORSConf.CorsAllowedHeaders,
+		AllowedMethods:   CORSConf.CorsAllowedMethods,
+		AllowedOrigins:   CORSConf.CorsAllowedOrigins,
+		ExposedHeaders:   CORSConf.CorsExposedHeaders,
+		MaxAge:           CORSConf.CorsMaxAge,
+	}
+	if 0 == len(opts.AllowedOrigins) {
+		// cors treats an empty origin list as "*".
+		opts.AllowOriginFunc = func(string) bool { return false }
+	}
+	return opts, ValidateCORSOptions(opts)
+}
+
+// NewCORS returns a CORS policy configured by the CORS_* environment
+// variables, to use with NewRouter in place of cors.AllowAll.
+func NewCORS() (*cors.Cors, error) {
+	opts, err := CORSOptions()
+	if nil != err {
+		return nil, err
+	}
+	return cors.New(opts), nil
+}
+
+// ValidateCORSOptions rejects CORS policies that allow credentials from any
+// origin. Browsers refuse credentialed responses with a wildcard
+// Access-Control-Allow-Origin, and echoing every origin instead would expose
+// authenticated responses to any site.
+func ValidateCORSOptions(opts cors.Options) error {
+	if !opts.AllowCredentials {
+		return nil
+	}
+	if 0 == len(opts.AllowedOrigins) && nil == opts.AllowOriginFunc && nil == opts.AllowOriginRequestFunc {
+		return errors.New("CORS credentials cannot be allowed for all origins")
+	}
+	for _, origin := range opts.AllowedOrigins {
+		if "*" == origin {
+			return errors.New("CORS credentials cannot be allowed for the wildcard origin")
+		}
+	}
+	return nil
+}
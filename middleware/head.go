@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Head is a middleware that serves HEAD requests with the handler of the
+// corresponding GET request, since the gateway only routes the HTTP methods
+// annotated in the proto definitions. The response body is discarded and its
+// length is reported in the Content-Length header, unless the handler set one
+// or flushed the response early, as streaming handlers do.
+func Head(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodHead != r.Method {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		get := new(http.Request)
+		*get = *r
+		get.Method = http.MethodGet
+
+		hw := &headResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(hw, get)
+		hw.writeHeader()
+	})
+}
+
+// headResponseWriter wraps a ResponseWriter in order to discard the body and
+// delay writing the header until the body length is known.
+type headResponseWriter struct {
+	http.ResponseWriter
+	length      int
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader lets headResponseWriter implement ResponseWriter, and will
+// record the status code.
+func (hw *headResponseWriter) WriteHeader(status int) {
+	if 0 == hw.status {
+		hw.status = status
+	}
+}
+
+// Write lets headResponseWriter implement ResponseWriter, and will count and
+// discard the body.
+func (hw *headResponseWriter) Write(b []byte) (int, error) {
+	if 0 == hw.status {
+		hw.status = http.StatusOK
+	}
+	hw.length += len(b)
+	return len(b), nil
+}
+
+// Flush lets headResponseWriter implement Flusher, and will write the header
+// without a Content-Length.
+func (hw *headResponseWriter) Flush() {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		if 0 == hw.status {
+			hw.status = http.StatusOK
+		}
+		hw.ResponseWriter.WriteHeader(hw.status)
+	}
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeHeader writes the recorded header, with the body length.
+func (hw *headResponseWriter) writeHeader() {
+	if hw.wroteHeader {
+		return
+	}
+	hw.wroteHeader = true
+	if 0 == hw.status {
+		hw.status = http.StatusOK
+	}
+	if "" == hw.Header().Get("Content-Length") && "" == hw.Header().Get("Transfer-Encoding") {
+		hw.Header().Set("Content-Length", strconv.Itoa(hw.length))
+	}
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
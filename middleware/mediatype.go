@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"io"
+	"mime"
+	"net/http"
+)
+
+// MediaType is a middleware that reduces the request Content-Type to its
+// media type, e.g. "multipart/form-data; boundary=x" to
+// "multipart/form-data", so that the gateway selects the marshaler
+// registered for it. The grpc-gateway only selects a marshaler registered for
+// exactly the Content-Type sent and falls back to the wildcard marshaler
+// otherwise, which parses any body with parameters, such as a charset or a
+// multipart boundary, as JSON.
+//
+// The media type parameters are passed on with the request body, which
+// implements
+//
+//	MediaTypeParam(name string) string
+//
+// returning the value of a parameter, so marshalers can read the multipart
+// boundary or the charset. Content-Type headers that can't be parsed are left
+// unchanged.
+func MediaType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if nil == err {
+			r.Header.Set("Content-Type", mediaType)
+			if 0 < len(params) && nil != r.Body {
+				r.Body = &mediaTypeBody{ReadCloser: r.Body, params: params}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mediaTypeBody is a request body carrying the parameters of the request
+// media type.
+type mediaTypeBody struct {
+	io.ReadCloser
+	params map[string]string
+}
+
+// MediaTypeParam returns the value of the media type parameter name, or an
+// empty string if it isn't set. Parameter names are lower case.
+func (b *mediaTypeBody) MediaTypeParam(name string) string {
+	return b.params[name]
+}
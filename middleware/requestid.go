@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// RequestIDHeader is the HTTP header carrying the request ID. The gateway
+// forwards it as the x-request-id metadata the log interceptor reads, so
+// HTTP and gRPC log entries share the ":request-id" field.
+var RequestIDHeader = http.CanonicalHeaderKey(log_interceptor.RequestIDKey)
+
+// maxRequestIDLength is the maximum length of a client provided request ID.
+const maxRequestIDLength = 128
+
+// RequestID is a middleware that makes sure every request has an ID in the
+// RequestIDHeader header, keeping a valid ID provided by the client or an
+// upstream proxy and generating a random one otherwise. The ID is also set
+// as a response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID reports whether a client provided request ID is safe to
+// log and forward: not empty, not too long, and printable ASCII.
+func validRequestID(id string) bool {
+	if "" == id || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128 bit request ID.
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	chi_middleware "github.com/go-chi/chi/middleware"
+	"github.com/rs/cors"
+)
+
+// NewRouter returns a chi router with the recommended middleware stack that
+// passes all requests to handler, usually the grpc-gateway multiplexer.
+//
+// The middleware is applied in this order:
+//   - CORS, answering preflight requests before anything else (skipped if c is nil)
+//   - RequestID, making sure every request has an X-Request-Id
+//   - AccessLog, logging every other request including recovered panics
+//   - Recoverer, turning handler panics into 500 responses
+//   - SecureHeaders
+//   - Head, serving HEAD requests with the GET handlers
+//   - Slashes, stripping trailing path slashes without a redirect
+//   - MediaType, reducing the Content-Type to the media type the gateway
+//     marshalers are registered for
+//   - DefaultCompress, GZIP compressing responses
+//
+// The handler is mounted as a catch-all route so the middleware stack applies
+// to every request; additional native routes may be registered on the
+// returned router and take precedence over the catch-all.
+func NewRouter(handler http.Handler, c *cors.Cors) *chi.Mux {
+	router := chi.NewRouter()
+	if nil != c {
+		router.Use(CORS(c))
+	}
+	router.Use(
+		RequestID,
+		AccessLog,
+		chi_middleware.Recoverer,
+		SecureHeaders,
+		Head,
+		Slashes(SlashRewrite),
+		MediaType,
+		chi_middleware.DefaultCompress,
+	)
+	router.Handle("/*", handler)
+	return router
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// SlashMode defines how Slashes handles request paths with a trailing slash.
+type SlashMode int
+
+const (
+	// SlashRewrite strips the trailing slash from the request path before
+	// routing, without a redirect.
+	SlashRewrite SlashMode = iota
+
+	// SlashRedirect answers with a 308 Permanent Redirect to the path without
+	// the trailing slash. Unlike 301 and 302 redirects, clients repeat the
+	// request with the same method and body.
+	SlashRedirect
+)
+
+// Slashes returns a middleware that normalizes request paths with a trailing
+// slash, e.g. "/v1/items/" to "/v1/items". It must be installed with the
+// router's Use method so it runs before routing. The root path is left as
+// it is.
+func Slashes(mode SlashMode) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.URL.Path) <= 1 || !strings.HasSuffix(r.URL.Path, "/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			path := strings.TrimRight(r.URL.Path, "/")
+			if "" == path {
+				path = "/"
+			}
+
+			if SlashRedirect == mode {
+				// collapse leading slashes, "//host" would redirect to
+				// another host.
+				target := *r.URL
+				target.Path = "/" + strings.TrimLeft(path, "/")
+				target.RawPath = ""
+				http.Redirect(w, r, target.RequestURI(), http.StatusPermanentRedirect)
+				return
+			}
+
+			r.URL.Path = path
+			if "" != r.URL.RawPath {
+				r.URL.RawPath = strings.TrimRight(r.URL.RawPath, "/")
+			}
+			if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok && "" != rctx.RoutePath {
+				rctx.RoutePath = strings.TrimRight(rctx.RoutePath, "/")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlashesRedirect(t *testing.T) {
+	handler := Slashes(SlashRedirect)(http.NotFoundHandler())
+	for _, test := range []struct {
+		target   string
+		code     int
+		location string
+	}{
+		{target: "/", code: http.StatusNotFound},
+		{target: "/v1/items", code: http.StatusNotFound},
+		{target: "/v1/items/", code: http.StatusPermanentRedirect, location: "/v1/items"},
+		{target: "/v1/items/?page=2", code: http.StatusPermanentRedirect, location: "/v1/items?page=2"},
+		{target: "//", code: http.StatusPermanentRedirect, location: "/"},
+		{target: "//evil.com/", code: http.StatusPermanentRedirect, location: "/evil.com"},
+		{target: "///evil.com/", code: http.StatusPermanentRedirect, location: "/evil.com"},
+		{target: "/%5Cevil.com/", code: http.StatusPermanentRedirect, location: "/%5Cevil.com"},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://example.com"+test.target, nil))
+		if test.code != w.Code {
+			t.Errorf("%s: got status %d, want %d", test.target, w.Code, test.code)
+		}
+		if location := w.Header().Get("Location"); test.location != location {
+			t.Errorf("%s: got location %q, want %q", test.target, location, test.location)
+		}
+	}
+}
+
+func TestSlashesRewrite(t *testing.T) {
+	path := ""
+	handler := Slashes(SlashRewrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/items/", nil))
+	if "/v1/items" != path {
+		t.Errorf("got path %q, want %q", path, "/v1/items")
+	}
+}
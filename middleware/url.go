@@ -0,0 +1,34 @@
+// Package middleware contains HTTP middleware helpers for the REST gateway.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MaxURLLength returns a middleware that rejects requests whose URL (path and
+// query string, as sent by the client) is longer than limit bytes with a
+// 414 Request-URI Too Long response, before the query is decoded by the
+// gateway. A limit of zero or less disables the check.
+func MaxURLLength(limit int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uri := r.RequestURI
+			if "" == uri {
+				uri = r.URL.RequestURI()
+			}
+			if len(uri) > limit {
+				http.Error(
+					w,
+					fmt.Sprintf("%s: request URI exceeds %d bytes", http.StatusText(http.StatusRequestURITooLong), limit),
+					http.StatusRequestURITooLong,
+				)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
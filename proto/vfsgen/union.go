@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dirList is a flag holding a list of directories, set by repeating the flag
+// or with a comma-separated list.
+type dirList []string
+
+// String implements flag.Value.
+func (d *dirList) String() string {
+	return strings.Join(*d, ",")
+}
+
+// Set implements flag.Value.
+func (d *dirList) Set(value string) error {
+	for _, dir := range strings.Split(value, ",") {
+		if dir = strings.TrimSpace(dir); "" != dir {
+			*d = append(*d, dir)
+		}
+	}
+	return nil
+}
+
+// unionFS merges directories into a single file tree. Directories present in
+// several of them are merged, files must be unique.
+type unionFS []http.FileSystem
+
+// newUnionFS returns the union of dirs, or an error naming the first file
+// found in more than one of them.
+func newUnionFS(dirs []string) (http.FileSystem, error) {
+	seen := map[string]string{}
+	union := unionFS{}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if other, ok := seen[rel]; ok {
+				return fmt.Errorf("file %q exists in both %s and %s", rel, other, dir)
+			}
+			seen[rel] = dir
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		union = append(union, http.Dir(dir))
+	}
+	return union, nil
+}
+
+// Open implements http.FileSystem.
+func (u unionFS) Open(name string) (http.File, error) {
+	var dirs []http.File
+	for _, fs := range u {
+		file, err := fs.Open(name)
+		if err != nil {
+			continue
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if !info.IsDir() {
+			for _, dir := range dirs {
+				dir.Close()
+			}
+			return file, nil
+		}
+		dirs = append(dirs, file)
+	}
+	if 0 == len(dirs) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &unionDir{File: dirs[0], dirs: dirs}, nil
+}
+
+// unionDir is a directory merged from several directories.
+type unionDir struct {
+	http.File
+	dirs []http.File
+}
+
+// Readdir returns the entries of all merged directories, sorted by name.
+// Subdirectories present in several directories are listed once.
+func (d *unionDir) Readdir(count int) ([]os.FileInfo, error) {
+	seen := map[string]bool{}
+	entries := []os.FileInfo{}
+	for _, dir := range d.dirs {
+		infos, err := dir.Readdir(0)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if !seen[info.Name()] {
+				seen[info.Name()] = true
+				entries = append(entries, info)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return entries, nil
+}
+
+// Close closes all merged directories.
+func (d *unionDir) Close() error {
+	var err error
+	for _, dir := range d.dirs {
+		if closeErr := dir.Close(); nil != closeErr {
+			err = closeErr
+		}
+	}
+	return err
+}
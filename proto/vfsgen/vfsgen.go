@@ -1,26 +1,56 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"strings"
 
+	"github.com/shurcooL/httpfs/vfsutil"
 	"github.com/shurcooL/vfsgen"
 )
 
 func main() {
 
-	dir := flag.String("dir", "", "The directory to recursively generate vfs / embedded-bindata for")
+	dirs := dirList{}
+	flag.Var(&dirs, "dir", "The directory to recursively generate vfs / embedded-bindata for; repeat or comma-separate to merge several directories into one tree")
 	outfile := flag.String("outfile", "", "The file path and name (include extension) to output the generated file")
 	pkg := flag.String("pkg", "", "The package name to give the vfs file")
 	tags := flag.String("tags", "", "The build tags to give the vfs generation")
 	variable := flag.String("variable", "", "The variable name to give the vfs (start with a capital letter if you want it exported)")
 	comment := flag.String("comment", "", "The comment to give the variable")
+	compress := flag.Bool("compress", true, "Store files gzip compressed when that makes them smaller; set to false to store all files uncompressed")
 
 	flag.Parse()
 
-	fmt.Printf("vfsgen for directory: %s; output to: %s; package name: %s; build tags: %s; variable name: %s; comment: %s\n", *dir, *outfile, *pkg, *tags, *variable, *comment)
-	err := vfsgen.Generate(http.Dir(*dir), vfsgen.Options{
+	// vfsgen names the output after the variable if no file is given.
+	if "" == *outfile {
+		name := *variable
+		if "" == name {
+			name = "assets"
+		}
+		*outfile = fmt.Sprintf("%s_vfsdata.go", strings.ToLower(name))
+	}
+
+	fmt.Printf("vfsgen for directory: %s; output to: %s; package name: %s; build tags: %s; variable name: %s; comment: %s; compress: %t\n", dirs.String(), *outfile, *pkg, *tags, *variable, *comment, *compress)
+	var fs http.FileSystem
+	if 1 == len(dirs) {
+		fs = http.Dir(dirs[0])
+	} else {
+		union, err := newUnionFS(dirs)
+		if err != nil {
+			panic(err)
+		}
+		fs = union
+	}
+	if !*compress {
+		fs = uncompressedFS{fs}
+	}
+	err := vfsgen.Generate(fs, vfsgen.Options{
 
 		// Filename of the generated Go code output (including extension)
 		Filename: *outfile,
@@ -41,4 +71,99 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+
+	files, size, stored, err := measure(fs)
+	if err != nil {
+		panic(err)
+	}
+	info, err := os.Stat(*outfile)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("vfsgen embedded %d files: %d bytes uncompressed, %d bytes stored, %d bytes of generated code\n", files, size, stored, info.Size())
+}
+
+// measure returns the number of files in fs, their total size and the number
+// of bytes vfsgen stores for them: the gzip compressed size of each file
+// that compression makes smaller, the size of the others.
+func measure(fs http.FileSystem) (files int, size, stored int64, err error) {
+	err = vfsutil.WalkFiles(fs, "/", func(path string, info os.FileInfo, r io.ReadSeeker, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		n, err := io.Copy(gw, r)
+		if err != nil {
+			return err
+		}
+		if err := gw.Close(); err != nil {
+			return err
+		}
+		files++
+		size += n
+		if int64(buf.Len()) < info.Size() {
+			stored += int64(buf.Len())
+		} else {
+			stored += n
+		}
+		return nil
+	})
+	return files, size, stored, err
+}
+
+// uncompressedFS reports a zero size for every file in the wrapped
+// filesystem. vfsgen stores a file uncompressed unless compressing it yields
+// fewer bytes than its reported size, and the generated code takes the size
+// from the stored content.
+type uncompressedFS struct {
+	http.FileSystem
+}
+
+// Open implements http.FileSystem.
+func (fs uncompressedFS) Open(name string) (http.File, error) {
+	file, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return uncompressedFile{file}, nil
+}
+
+// uncompressedFile reports a zero size for itself and the files in it.
+type uncompressedFile struct {
+	http.File
+}
+
+// Stat implements http.File.
+func (f uncompressedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return zeroSizeInfo{info}, nil
+}
+
+// Readdir implements http.File.
+func (f uncompressedFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	for i := range infos {
+		infos[i] = zeroSizeInfo{infos[i]}
+	}
+	return infos, err
+}
+
+// zeroSizeInfo reports a zero size for files.
+type zeroSizeInfo struct {
+	os.FileInfo
+}
+
+// Size implements os.FileInfo.
+func (info zeroSizeInfo) Size() int64 {
+	if info.IsDir() {
+		return info.FileInfo.Size()
+	}
+	return 0
 }
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// BaseContext contains gRPC interceptor middleware methods that derive each
+// request context from the server lifecycle, so handlers observe the server
+// shutdown through ctx.Done():
+//   - stream contexts are canceled as soon as the shutdown starts, so
+//     long-running streams abort instead of holding up the graceful stop
+//     until the shutdown timeout
+//   - unary request contexts are only canceled once the shutdown timeout
+//     elapses and the remaining connections are closed, so in-flight
+//     requests are drained gracefully
+//
+// The server doesn't exist yet when the gRPC server interceptors are set, so
+// the same BaseContext is passed to New with WithBaseContext:
+//
+//	base := &server.BaseContext{}
+//	grpcServer := server.NewGRPCServer(server.WithGRPCServerOptions(
+//		grpc.StreamInterceptor(base.StreamInterceptor),
+//		grpc.UnaryInterceptor(base.UnaryInterceptor),
+//	))
+//	tcpServer, err := server.New(ctx, handler, grpcServer, server.WithBaseContext(base))
+//
+// Requests are served with their own context until New is called.
+//
+// Interceptors chained before BaseContext see the request context of the
+// client, interceptors chained after it see the derived context, which is
+// also canceled on shutdown. Logging interceptors telling client
+// cancellations apart, such as the log_interceptor.Interceptor CancelPolicy,
+// must therefore be chained before BaseContext.
+type BaseContext struct {
+	drain context.Context // drain is done when the shutdown starts
+	mux   sync.RWMutex
+	stop  context.Context // stop is done when the shutdown timeout elapses
+}
+
+// UnaryInterceptor is a grpc interceptor middleware that cancels the request
+// context when the server shutdown timeout elapses.
+func (bc *BaseContext) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, cancel := bc.derive(ctx, false)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+// StreamInterceptor is a grpc interceptor middleware that cancels the stream
+// context when the server shutdown starts.
+func (bc *BaseContext) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, cancel := bc.derive(stream.Context(), true)
+	defer cancel()
+	return handler(srv, &baseContextServerStream{ServerStream: stream, ctx: ctx})
+}
+
+// set sets the server contexts.
+func (bc *BaseContext) set(drain, stop context.Context) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.drain = drain
+	bc.stop = stop
+}
+
+// derive returns a copy of the request context that is also canceled when
+// the shutdown starts if drain is true, or when the shutdown timeout elapses
+// otherwise.
+func (bc *BaseContext) derive(ctx context.Context, drain bool) (context.Context, context.CancelFunc) {
+	bc.mux.RLock()
+	base := bc.stop
+	if drain {
+		base = bc.drain
+	}
+	bc.mux.RUnlock()
+	if nil == base {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-base.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// baseContextServerStream wraps a ServerStream in order to replace its
+// context.
+type baseContextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context lets baseContextServerStream implement ServerStream, and will
+// return the derived context.
+func (s *baseContextServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBaseContextDrainAndStop(t *testing.T) {
+	drain, drainCancel := context.WithCancel(context.Background())
+	stop, stopCancel := context.WithCancel(context.Background())
+	bc := &BaseContext{}
+	bc.set(drain, stop)
+
+	unary, unaryCancel := bc.derive(context.Background(), false)
+	defer unaryCancel()
+	stream, streamCancel := bc.derive(context.Background(), true)
+	defer streamCancel()
+
+	drainCancel()
+	select {
+	case <-stream.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream context not canceled when the shutdown started")
+	}
+	select {
+	case <-unary.Done():
+		t.Fatal("unary context canceled before the shutdown timeout")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	stopCancel()
+	select {
+	case <-unary.Done():
+	case <-time.After(time.Second):
+		t.Fatal("unary context not canceled when the shutdown timed out")
+	}
+}
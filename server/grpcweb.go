@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+)
+
+// grpcWebHandler returns a handler serving gRPC-Web requests, including their
+// CORS preflight requests, with the gRPC server, and passing all other
+// requests to handler. Cross-origin gRPC-Web requests are only allowed from
+// GRPC_WEB_ALLOWED_ORIGINS.
+func grpcWebHandler(grpcServer *grpc.Server, handler http.Handler) http.Handler {
+	wrapped := grpcweb.WrapServer(grpcServer, grpcweb.WithOriginFunc(grpcWebOrigin))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// grpcWebOrigin reports whether cross-origin gRPC-Web requests are allowed
+// from origin.
+func grpcWebOrigin(origin string) bool {
+	for _, allowed := range Conf.GrpcWebAllowedOrigins {
+		if "*" == allowed || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthService is the name of the standard gRPC health service.
+const healthService = "grpc.health.v1.Health"
+
+// registerHealth registers the standard grpc.health.v1.Health service, unless
+// the application registered its own, and reports the server and all
+// registered services as serving.
+func (server *Server) registerHealth() {
+	services := server.grpcServer.GetServiceInfo()
+	if _, ok := services[healthService]; ok {
+		server.logger().Info("gRPC health service already registered")
+		return
+	}
+	healthpb.RegisterHealthServer(server.grpcServer, server.health)
+	for service := range services {
+		server.health.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	}
+}
+
+// SetServingStatus sets the status reported by the gRPC health service for a
+// service, "" for the server as a whole, e.g. to report the server as not
+// serving until its dependencies are available. It has no effect once the
+// server is shutting down, when all services are reported as not serving.
+func (server *Server) SetServingStatus(service string, serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	server.health.SetServingStatus(service, status)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/bdlm/log"
+)
+
+// Lameduck reports whether the server is in lameduck mode: still serving, but
+// reporting itself as not ready so load balancers stop sending it new
+// traffic before it is stopped. Lameduck mode is entered while the file
+// configured with LAMEDUCK_FILE exists.
+func (server *Server) Lameduck() bool {
+	return 1 == atomic.LoadInt32(&server.lameduck)
+}
+
+// Draining reports whether Drain has been called.
+func (server *Server) Draining() bool {
+	return 1 == atomic.LoadInt32(&server.draining)
+}
+
+// Drain shuts the server down after giving load balancers time to stop
+// sending it traffic. It reports the server as not ready and its gRPC
+// services as not serving, disables HTTP keep-alives so clients reconnect to
+// other instances, and keeps serving for the drain period before shutting
+// down. It blocks until the shutdown is complete.
+func (server *Server) Drain() {
+	if !atomic.CompareAndSwapInt32(&server.draining, 0, 1) {
+		server.wg.Wait()
+		return
+	}
+	server.logger().WithField("period", server.opts.DrainPeriod.String()).Info("draining server")
+	server.health.Shutdown()
+	server.httpServer.SetKeepAlivesEnabled(false)
+
+	select {
+	case <-time.After(server.opts.DrainPeriod):
+	case <-server.ctx.Done():
+	}
+	server.Shutdown()
+}
+
+// ReadinessHandler is a readiness probe handler that responds with 200 OK
+// while the server accepts traffic and 503 Service Unavailable in lameduck
+// mode or while draining.
+func (server *Server) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if server.Draining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	if server.Lameduck() {
+		http.Error(w, "lameduck", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// watchLameduck polls for the lameduck file until the server context is
+// cancelled, entering lameduck mode while the file exists.
+func (server *Server) watchLameduck(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := os.Stat(path)
+		exists := nil == err
+		var state int32
+		if exists {
+			state = 1
+		}
+		if atomic.SwapInt32(&server.lameduck, state) != state {
+			server.logger().WithFields(log.Fields{
+				"file":     path,
+				"lameduck": exists,
+			}).Info("lameduck mode changed")
+		}
+
+		select {
+		case <-server.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
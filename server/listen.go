@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/pkg/errors"
+)
+
+// listen creates a listener on address, applying the configured socket
+// buffer sizes. Addresses in the form "unix:///path/to/socket" listen on a
+// Unix domain socket, other addresses on the given network, "tcp" by default.
+// A stale socket file left behind by a previous process is removed before
+// binding, and the socket file is removed when the listener is closed.
+//
+// SO_RCVBUF and SO_SNDBUF are set through the net.ListenConfig Control hook,
+// before the socket is bound, so accepted connections inherit them. The
+// kernel treats the values as hints: Linux doubles the requested size for
+// bookkeeping overhead and clamps it to net.core.rmem_max/wmem_max, and other
+// platforms apply their own limits, so the effective sizes may differ from
+// the requested ones.
+func listen(network, address string) (net.Listener, error) {
+	if strings.HasPrefix(address, "unix://") {
+		network, address = "unix", strings.TrimPrefix(address, "unix://")
+	}
+	if "" == network {
+		network = "tcp"
+	}
+	if "unix" == network {
+		if info, err := os.Stat(address); nil == err && 0 != info.Mode()&os.ModeSocket {
+			if err := os.Remove(address); nil != err {
+				return nil, errors.Wrap(err, "could not remove stale socket file")
+			}
+		}
+	}
+
+	config := net.ListenConfig{}
+	if Conf.RecvBufferSize > 0 || Conf.SendBufferSize > 0 {
+		config.Control = func(network, address string, conn syscall.RawConn) error {
+			var sockErr error
+			err := conn.Control(func(fd uintptr) {
+				sockErr = setSockoptBuffers(fd, Conf.RecvBufferSize, Conf.SendBufferSize)
+			})
+			if nil != err {
+				return err
+			}
+			return errors.Wrap(sockErr, "could not set socket buffer sizes")
+		}
+	}
+	return config.Listen(context.Background(), network, address)
+}
+
+// listener returns the pre-created listener l if set, and a new listener on
+// address otherwise.
+func listener(l net.Listener, network, address string) (net.Listener, error) {
+	if nil != l {
+		return l, nil
+	}
+	return listen(network, address)
+}
+
+// listeners binds the gRPC and HTTP listeners and returns the functions that
+// serve on them. serveGRPC is nil if gRPC is served by the HTTP server.
+func (server *Server) listeners() (serveGRPC, serveHTTP func() error, err error) {
+	if server.opts.SinglePort {
+		return server.singlePortListeners()
+	}
+
+	grpcListener, err := listener(server.opts.GRPCListener, Conf.GrpcNetwork, Conf.GrpcAddress)
+	if nil != err {
+		return nil, nil, errors.Wrap(err, "could not create gRPC listener")
+	}
+	httpListener, err := listener(server.opts.HTTPListener, "", server.httpServer.Addr)
+	if nil != err {
+		grpcListener.Close()
+		return nil, nil, errors.Wrap(err, "could not create HTTP listener")
+	}
+	server.setAddrs(grpcListener.Addr(), httpListener.Addr())
+	grpcListener = server.proxyProtocol(grpcListener)
+	httpListener = server.proxyProtocol(httpListener)
+
+	serveGRPC = func() error {
+		return server.grpcServer.Serve(grpcListener)
+	}
+	serveHTTP = func() error {
+		return server.serveHTTP(httpListener)
+	}
+	return serveGRPC, serveHTTP, nil
+}
+
+// proxyProtocol returns l wrapped to read the PROXY protocol (v1 or v2)
+// header load balancers send ahead of each connection, if enabled with
+// WithProxyProtocol or PROXY_PROTOCOL, so connections report the real client
+// address as their remote address, which gRPC reports as the peer address.
+// Connections without a header are served as is.
+//
+// Any client that can reach the listener can send a header, so it must only
+// be enabled when the server is reachable through the load balancer alone.
+func (server *Server) proxyProtocol(l net.Listener) net.Listener {
+	if !server.opts.ProxyProtocol && !Conf.ProxyProtocol {
+		return l
+	}
+	return &proxyproto.Listener{Listener: l, ReadHeaderTimeout: server.opts.ReadHeaderTimeout}
+}
+
+// serveHTTP serves the REST gateway on a listener, over TLS if configured.
+func (server *Server) serveHTTP(listener net.Listener) error {
+	if nil != server.httpServer.TLSConfig {
+		// certificates are provided by the TLS configuration.
+		return server.httpServer.ServeTLS(listener, "", "")
+	}
+	return server.httpServer.Serve(listener)
+}
+
+// setAddrs records the addresses the listeners are bound to.
+func (server *Server) setAddrs(grpcAddr, httpAddr net.Addr) {
+	server.addrMux.Lock()
+	defer server.addrMux.Unlock()
+	server.grpcAddr = grpcAddr
+	server.httpAddr = httpAddr
+}
+
+// GRPCAddr returns the address the gRPC server listens on, e.g. to discover
+// the port assigned when listening on ":0". It returns nil until Start has
+// bound the listeners. In single port mode it is the same as HTTPAddr.
+func (server *Server) GRPCAddr() net.Addr {
+	server.addrMux.RLock()
+	defer server.addrMux.RUnlock()
+	return server.grpcAddr
+}
+
+// HTTPAddr returns the address the REST gateway listens on, e.g. to discover
+// the port assigned when listening on ":0". It returns nil until Start has
+// bound the listeners.
+func (server *Server) HTTPAddr() net.Addr {
+	server.addrMux.RLock()
+	defer server.addrMux.RUnlock()
+	return server.httpAddr
+}
@@ -0,0 +1,16 @@
+package server
+
+import log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+
+// logger returns the server Logger, or the global logger if it isn't set.
+func (server *Server) logger() log_interceptor.Logger {
+	return logEntry(server.Logger)
+}
+
+// logEntry returns logger, or the global logger if it is nil.
+func logEntry(logger log_interceptor.Logger) log_interceptor.Logger {
+	if nil != logger {
+		return logger
+	}
+	return log_interceptor.NewLogger(nil)
+}
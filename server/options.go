@@ -0,0 +1,354 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+)
+
+// Options defines optional server settings, set with Option functions passed
+// to New.
+type Options struct {
+	BaseContext       *BaseContext                 // BaseContext if set is bound to the server context by New
+	DrainPeriod       time.Duration                // DrainPeriod if set overrides DRAIN_PERIOD
+	GRPCListener      net.Listener                 // GRPCListener if set serves gRPC on this listener instead of GRPC_ADDRESS
+	GRPCServerOptions []grpc.ServerOption          // GRPCServerOptions are appended to the options built by NewGRPCServer
+	GRPCTLSConfig     *tls.Config                  // GRPCTLSConfig if set serves gRPC over TLS with this configuration, see WithGRPCTLSConfig
+	GRPCWeb           bool                         // GRPCWeb if true serves gRPC-Web requests on the REST address, see GRPC_WEB
+	H2C               bool                         // H2C if true serves the REST gateway over HTTP/2 cleartext as well as HTTP/1.1, see HTTP2_CLEARTEXT
+	HTTPListener      net.Listener                 // HTTPListener if set serves the REST gateway on this listener instead of REST_ADDRESS
+	HTTPTLSConfig     *tls.Config                  // HTTPTLSConfig if set serves the REST gateway over TLS with this configuration
+	IdleTimeout       time.Duration                // IdleTimeout if set overrides IDLE_TIMEOUT and the package IdleTimeout
+	Keepalive         *keepalive.ServerParameters  // Keepalive if set overrides the KEEPALIVE_* server parameters
+	KeepalivePolicy   *keepalive.EnforcementPolicy // KeepalivePolicy if set overrides KEEPALIVE_MIN_TIME and KEEPALIVE_PERMIT_WITHOUT_STREAM
+	Logger            log_interceptor.Logger       // Logger if set is logged to instead of the global logger, see Server.Logger
+	MaxRecvMsgSize    int                          // MaxRecvMsgSize if set overrides MAX_RECV_MSG_SIZE
+	MaxSendMsgSize    int                          // MaxSendMsgSize if set overrides MAX_SEND_MSG_SIZE
+	ProxyProtocol     bool                         // ProxyProtocol if true reads the client address from PROXY protocol headers, see PROXY_PROTOCOL
+	ReadHeaderTimeout time.Duration                // ReadHeaderTimeout if set overrides READ_HEADER_TIMEOUT
+	ReadTimeout       time.Duration                // ReadTimeout if set overrides READ_TIMEOUT and the package ReadTimeout
+	ShutdownTimeout   time.Duration                // ShutdownTimeout if set overrides SHUTDOWN_TIMEOUT
+	SinglePort        bool                         // SinglePort if true serves gRPC and the REST gateway on the REST address
+	TLSConfig         *tls.Config                  // TLSConfig if set serves both transports over TLS, unless they have their own configuration
+	WriteTimeout      time.Duration                // WriteTimeout if set overrides WRITE_TIMEOUT and the package WriteTimeout
+}
+
+// Option sets an optional server setting.
+type Option func(*Options)
+
+// newOptions returns the settings with all options applied.
+func newOptions(opts []Option) Options {
+	options := Options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// grpcServerOptions returns the gRPC server options for the settings: the
+// built-in options, followed by GRPCServerOptions.
+func (options Options) grpcServerOptions() []grpc.ServerOption {
+	serverOptions := []grpc.ServerOption{}
+
+	// keepalive, zero values use the gRPC defaults.
+	params := keepalive.ServerParameters{
+		MaxConnectionAge:      Conf.KeepaliveMaxConnectionAge,
+		MaxConnectionAgeGrace: Conf.KeepaliveMaxConnectionAgeGrace,
+		MaxConnectionIdle:     Conf.KeepaliveMaxConnectionIdle,
+		Time:                  Conf.KeepaliveTime,
+		Timeout:               Conf.KeepaliveTimeout,
+	}
+	if nil != options.Keepalive {
+		params = *options.Keepalive
+	}
+	if (keepalive.ServerParameters{}) != params {
+		serverOptions = append(serverOptions, grpc.KeepaliveParams(params))
+	}
+	policy := keepalive.EnforcementPolicy{
+		MinTime:             Conf.KeepaliveMinTime,
+		PermitWithoutStream: Conf.KeepalivePermitWithoutStream,
+	}
+	if nil != options.KeepalivePolicy {
+		policy = *options.KeepalivePolicy
+	}
+	if (keepalive.EnforcementPolicy{}) != policy {
+		serverOptions = append(serverOptions, grpc.KeepaliveEnforcementPolicy(policy))
+	}
+
+	// message size limits, zero values use the gRPC defaults.
+	maxRecv, maxSend := Conf.MaxRecvMsgSize, Conf.MaxSendMsgSize
+	if 0 != options.MaxRecvMsgSize {
+		maxRecv = options.MaxRecvMsgSize
+	}
+	if 0 != options.MaxSendMsgSize {
+		maxSend = options.MaxSendMsgSize
+	}
+	if 0 != maxRecv {
+		serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(maxRecv))
+	}
+	if 0 != maxSend {
+		serverOptions = append(serverOptions, grpc.MaxSendMsgSize(maxSend))
+	}
+
+	// TLS transport credentials. A certificate that can't be loaded is
+	// reported by New, which resolves the same configuration.
+	if err := options.resolveTLS(); nil == err && nil != options.GRPCTLSConfig {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(options.GRPCTLSConfig)))
+	}
+
+	return append(serverOptions, options.GRPCServerOptions...)
+}
+
+// NewGRPCServer returns a new gRPC server built from the settings, such as the
+// keepalive parameters, message size limits and TLS, to be passed to New along
+// with the same options. New takes a pre-built server, so these settings
+// only apply to servers built with NewGRPCServer.
+func NewGRPCServer(opts ...Option) *grpc.Server {
+	return grpc.NewServer(newOptions(opts).grpcServerOptions()...)
+}
+
+// WithBaseContext binds a BaseContext to the server lifecycle, so request
+// contexts derived by its interceptors are canceled when the server shuts
+// down, see BaseContext.
+func WithBaseContext(base *BaseContext) Option {
+	return func(opts *Options) {
+		opts.BaseContext = base
+	}
+}
+
+// WithDrainPeriod sets the time Drain keeps serving while reporting the
+// server as not ready, overriding DRAIN_PERIOD. It should exceed the time
+// load balancers take to notice a failing readiness probe.
+func WithDrainPeriod(period time.Duration) Option {
+	return func(opts *Options) {
+		opts.DrainPeriod = period
+	}
+}
+
+// WithGRPCServerOptions appends options, such as interceptors, stats handlers
+// or credentials, to the gRPC server options NewGRPCServer builds from the
+// other settings. They are applied after the built-in options, so options
+// that hold a single value, such as message size limits, override the
+// built-in ones. Interceptors can only be set once; chain them with
+// grpc_middleware.ChainUnaryServer and grpc_middleware.ChainStreamServer.
+func WithGRPCServerOptions(opts ...grpc.ServerOption) Option {
+	return func(options *Options) {
+		options.GRPCServerOptions = append(options.GRPCServerOptions, opts...)
+	}
+}
+
+// WithGRPCTLSConfig serves gRPC over TLS with the given configuration, e.g.
+// with an internal CA and tls.RequireAndVerifyClientCert for mTLS.
+//
+// TLS is set as the gRPC server's transport credentials by NewGRPCServer, so
+// handlers see the client certificates in the peer AuthInfo; pass the same
+// option to NewGRPCServer and New. Servers not built with NewGRPCServer need
+// grpc.Creds(credentials.NewTLS(config)) instead.
+func WithGRPCTLSConfig(config *tls.Config) Option {
+	return func(opts *Options) {
+		opts.GRPCTLSConfig = config
+	}
+}
+
+// WithGRPCWeb serves gRPC-Web requests, identified by their
+// "application/grpc-web" content types, with the gRPC server on the REST
+// address, so browsers can call the gRPC services without the JSON gateway.
+// All other requests are passed to the REST handler. Cross-origin requests
+// are allowed from GRPC_WEB_ALLOWED_ORIGINS.
+func WithGRPCWeb() Option {
+	return func(opts *Options) {
+		opts.GRPCWeb = true
+	}
+}
+
+// WithH2C serves the REST gateway over HTTP/2 cleartext (h2c) as well as
+// HTTP/1.1, for proxies that terminate TLS and forward HTTP/2 to the server.
+// It has no effect when the REST gateway is served over TLS, which
+// negotiates HTTP/2 itself. The stream limit is set with
+// HTTP2_MAX_CONCURRENT_STREAMS.
+func WithH2C() Option {
+	return func(opts *Options) {
+		opts.H2C = true
+	}
+}
+
+// WithHTTPTLSConfig serves the REST gateway over TLS with the given
+// configuration, e.g. with a certificate from a public CA for browsers.
+//
+// The gRPC and REST transports listen on separate addresses, so each gets its
+// own certificates and client authentication policy. In single port mode a
+// single handshake serves both, and the HTTP configuration is used for both.
+func WithHTTPTLSConfig(config *tls.Config) Option {
+	return func(opts *Options) {
+		opts.HTTPTLSConfig = config
+	}
+}
+
+// WithTimeouts sets the REST gateway read, write and idle timeouts of a
+// server, overriding the environment and package defaults. Zero values keep
+// the defaults.
+func WithTimeouts(read, write, idle time.Duration) Option {
+	return func(opts *Options) {
+		opts.ReadTimeout = read
+		opts.WriteTimeout = write
+		opts.IdleTimeout = idle
+	}
+}
+
+// WithKeepalive sets the gRPC server keepalive parameters and the policy
+// enforced on client keepalive pings, overriding the KEEPALIVE_* environment
+// settings. Either may be nil to keep the environment settings. Clients
+// behind NAT gateways or load balancers that drop idle connections should
+// ping more often than the idle timeout, and the policy must permit it or
+// the server closes their connections.
+func WithKeepalive(params *keepalive.ServerParameters, policy *keepalive.EnforcementPolicy) Option {
+	return func(opts *Options) {
+		opts.Keepalive = params
+		opts.KeepalivePolicy = policy
+	}
+}
+
+// WithListeners serves gRPC and the REST gateway on pre-created listeners
+// instead of binding GRPC_ADDRESS and REST_ADDRESS, e.g. listeners bound to
+// ":0" in tests or inherited from a socket activation system. Either may be
+// nil to bind the configured address. The server takes ownership of the
+// listeners and closes them on shutdown. In single port mode only the HTTP
+// listener is used.
+func WithListeners(grpcListener, httpListener net.Listener) Option {
+	return func(opts *Options) {
+		opts.GRPCListener = grpcListener
+		opts.HTTPListener = httpListener
+	}
+}
+
+// WithLogger sets the logger the server logs to instead of the global
+// logger. A *log.Logger is adapted with log_interceptor.NewLogger.
+func WithLogger(logger log_interceptor.Logger) Option {
+	return func(opts *Options) {
+		opts.Logger = logger
+	}
+}
+
+// WithMaxMsgSize sets the maximum size in bytes of messages the gRPC server
+// receives and sends, overriding MAX_RECV_MSG_SIZE and MAX_SEND_MSG_SIZE;
+// 0 keeps the configured value. Larger messages fail with
+// ResourceExhausted. The gateway's connection to the server has its own
+// client limits, raised with grpc.WithDefaultCallOptions and
+// grpc.MaxCallRecvMsgSize and grpc.MaxCallSendMsgSize in its dial options.
+func WithMaxMsgSize(recv, send int) Option {
+	return func(opts *Options) {
+		opts.MaxRecvMsgSize = recv
+		opts.MaxSendMsgSize = send
+	}
+}
+
+// WithProxyProtocol reads the PROXY protocol header load balancers, such as
+// an AWS NLB, send ahead of each connection, so the real client address is
+// reported as the peer address instead of the load balancer's. It must only
+// be used when the server is reachable through the load balancer alone, as
+// any client can send a header.
+func WithProxyProtocol() Option {
+	return func(opts *Options) {
+		opts.ProxyProtocol = true
+	}
+}
+
+// WithReadHeaderTimeout sets the time allowed to read the request headers of
+// REST gateway requests, overriding READ_HEADER_TIMEOUT. Zero keeps the
+// environment setting.
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.ReadHeaderTimeout = timeout
+	}
+}
+
+// WithShutdownTimeout sets the time allowed for in-flight requests to
+// complete on shutdown, overriding SHUTDOWN_TIMEOUT. Connections still active
+// after it elapses are closed.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.ShutdownTimeout = timeout
+	}
+}
+
+// WithSinglePort serves gRPC and the REST gateway on a single port, the
+// REST_ADDRESS, for environments that only expose one port. GRPC_ADDRESS is
+// not used.
+func WithSinglePort() Option {
+	return func(opts *Options) {
+		opts.SinglePort = true
+	}
+}
+
+// WithTLSConfig serves both gRPC and the REST gateway over TLS with the given
+// configuration, unless a transport has its own configuration set with
+// WithGRPCTLSConfig or WithHTTPTLSConfig. Without any TLS configuration,
+// the certificate and key files configured with TLS_CERT_FILE and
+// TLS_KEY_FILE are used, if set, and plaintext is served otherwise. As with
+// WithGRPCTLSConfig, gRPC TLS is set up by NewGRPCServer.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(opts *Options) {
+		opts.TLSConfig = config
+	}
+}
+
+// resolveTLS sets the TLS configuration of each transport, falling back to
+// the shared configuration and then to the configured certificate files.
+func (options *Options) resolveTLS() error {
+	shared := options.TLSConfig
+	if nil == shared && "" != Conf.TLSCertFile {
+		cert, err := tls.LoadX509KeyPair(Conf.TLSCertFile, Conf.TLSKeyFile)
+		if nil != err {
+			return errors.Wrap(err, "could not load TLS certificate")
+		}
+		shared = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if nil == options.GRPCTLSConfig {
+		options.GRPCTLSConfig = shared
+	}
+	if nil == options.HTTPTLSConfig {
+		options.HTTPTLSConfig = shared
+	}
+	return nil
+}
+
+// resolveTimeouts sets each unset timeout from the environment, falling back
+// to the package defaults.
+func (options *Options) resolveTimeouts() {
+	for _, timeout := range []struct {
+		value    *time.Duration
+		env      time.Duration
+		fallback time.Duration
+	}{
+		{&options.IdleTimeout, Conf.IdleTimeout, IdleTimeout},
+		{&options.ReadTimeout, Conf.ReadTimeout, ReadTimeout},
+		{&options.WriteTimeout, Conf.WriteTimeout, WriteTimeout},
+	} {
+		if 0 != *timeout.value {
+			continue
+		}
+		*timeout.value = timeout.env
+		if 0 == *timeout.value {
+			*timeout.value = timeout.fallback
+		}
+	}
+
+	if 0 == options.DrainPeriod {
+		options.DrainPeriod = Conf.DrainPeriod
+	}
+	if 0 == options.ShutdownTimeout {
+		options.ShutdownTimeout = Conf.ShutdownTimeout
+	}
+
+	// a zero header timeout falls back to the read timeout in net/http.
+	if 0 == options.ReadHeaderTimeout {
+		options.ReadHeaderTimeout = Conf.ReadHeaderTimeout
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// echoService returns the received message.
+var echoService = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := &wrappers.StringValue{}
+			if err := dec(in); nil != err {
+				return nil, err
+			}
+			return in, nil
+		},
+	}},
+}
+
+func TestWithMaxMsgSize(t *testing.T) {
+	// a string value of n bytes, 128 <= n < 16384, encodes as a tag byte,
+	// a 2 byte length and the string.
+	const overhead = 3
+	const limit = 1024
+
+	for _, test := range []struct {
+		name       string
+		recv, send int
+		size       int
+		code       codes.Code
+	}{
+		{name: "receive just under", recv: limit, size: limit - 1, code: codes.OK},
+		{name: "receive at limit", recv: limit, size: limit, code: codes.OK},
+		{name: "receive just over", recv: limit, size: limit + 1, code: codes.ResourceExhausted},
+		{name: "send just under", recv: 2 * limit, send: limit, size: limit - 1, code: codes.OK},
+		{name: "send at limit", recv: 2 * limit, send: limit, size: limit, code: codes.OK},
+		{name: "send just over", recv: 2 * limit, send: limit, size: limit + 1, code: codes.ResourceExhausted},
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatal(err)
+		}
+		grpcServer := NewGRPCServer(WithMaxMsgSize(test.recv, test.send))
+		grpcServer.RegisterService(&echoService, struct{}{})
+		go grpcServer.Serve(listener)
+
+		conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+		if nil != err {
+			t.Fatal(err)
+		}
+		in := &wrappers.StringValue{Value: strings.Repeat("x", test.size-overhead)}
+		err = conn.Invoke(context.Background(), "/test.Echo/Echo", in, &wrappers.StringValue{})
+		if code := status.Code(err); test.code != code {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.code)
+		}
+		conn.Close()
+		grpcServer.Stop()
+	}
+}
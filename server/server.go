@@ -4,16 +4,23 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 
-	"github.com/bdlm/log"
 	"github.com/kelseyhightower/envconfig"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/reflection"
 
+	log_interceptor "github.com/bdlm/grpc-gateway-wrapper/interceptor/log"
+
 	// gzip encode GRPC responses
 	_ "google.golang.org/grpc/encoding/gzip"
 )
@@ -28,115 +35,325 @@ func init() {
 // Conf contains the server configuration values.
 var Conf serverEnv
 
-// ReadTimeout defines the default server read timeout.
+// ReadTimeout defines the default server read timeout, used when neither the
+// ReadTimeout option nor READ_TIMEOUT is set. It is read by New.
 var ReadTimeout = 5 * time.Minute
 
-// WriteTimeout defines the default server write timeout.
+// WriteTimeout defines the default server write timeout, used when neither
+// the WriteTimeout option nor WRITE_TIMEOUT is set. It is read by New.
 var WriteTimeout = 5 * time.Minute
 
-// IdleTimeout defines the default server idle timeout.
+// IdleTimeout defines the default server idle timeout, used when neither the
+// IdleTimeout option nor IDLE_TIMEOUT is set. It is read by New.
 var IdleTimeout = 5 * time.Minute
 
 // Server defines metadata for managing gRPC and REST servers.
 type Server struct {
-	cancel     context.CancelFunc
-	ctx        context.Context
-	grpcServer *grpc.Server
-	httpServer *http.Server
-	wg         *sync.WaitGroup
+	Logger           log_interceptor.Logger // Logger if set will be logged to instead of the global logger
+	RegisterServices func(*grpc.Server)     // RegisterServices if set is called by Start to register the gRPC services before reflection is enabled
+
+	addrMux      sync.RWMutex
+	cancel       context.CancelFunc
+	ctx          context.Context
+	draining     int32
+	grpcAddr     net.Addr
+	grpcServer   *grpc.Server
+	health       *health.Server
+	httpAddr     net.Addr
+	httpServer   *http.Server
+	lameduck     int32
+	opts         Options
+	ready        chan struct{}
+	registerOnce sync.Once
+	rootListener net.Listener
+	started      int32
+	stop         context.CancelFunc
+	wg           *sync.WaitGroup
 }
 
 // serverEnv defines the environment configuration needed for this server.
 type serverEnv struct {
-	GrpcAddress string `default:":50051" split_words:"true"` // GRPC_ADDRESS
-	RestAddress string `default:":80" split_words:"true"`    // REST_ADDRESS
+	Channelz                       bool          `default:"false"`                     // CHANNELZ, register the channelz service on the gRPC server
+	DrainPeriod                    time.Duration `default:"10s" split_words:"true"`    // DRAIN_PERIOD, time Drain keeps serving while reporting not ready
+	GrpcAddress                    string        `default:":50051" split_words:"true"` // GRPC_ADDRESS, a host:port, or unix:///path/to/socket
+	GrpcNetwork                    string        `default:"tcp" split_words:"true"`    // GRPC_NETWORK, tcp or unix
+	GrpcWeb                        bool          `default:"false" split_words:"true"`  // GRPC_WEB, serve gRPC-Web requests on the REST address
+	GrpcWebAllowedOrigins          []string      `split_words:"true"`                  // GRPC_WEB_ALLOWED_ORIGINS, origins allowed to make cross-origin gRPC-Web requests, "*" for all
+	HardStop                       bool          `default:"false" split_words:"true"`  // HARD_STOP, exit the process if shutdown doesn't complete within HARD_STOP_TIMEOUT
+	HardStopTimeout                time.Duration `default:"10m" split_words:"true"`    // HARD_STOP_TIMEOUT
+	Http2Cleartext                 bool          `default:"false" split_words:"true"`  // HTTP2_CLEARTEXT, serve the REST gateway over HTTP/2 cleartext (h2c) as well as HTTP/1.1
+	Http2MaxConcurrentStreams      uint32        `default:"250" split_words:"true"`    // HTTP2_MAX_CONCURRENT_STREAMS, per h2c connection
+	IdleTimeout                    time.Duration `default:"0" split_words:"true"`      // IDLE_TIMEOUT, 0 for the package IdleTimeout
+	KeepaliveMaxConnectionAge      time.Duration `default:"0" split_words:"true"`      // KEEPALIVE_MAX_CONNECTION_AGE, close connections after this age, 0 for no limit
+	KeepaliveMaxConnectionAgeGrace time.Duration `default:"0" split_words:"true"`      // KEEPALIVE_MAX_CONNECTION_AGE_GRACE, time allowed for RPCs to complete after the max age, 0 for no limit
+	KeepaliveMaxConnectionIdle     time.Duration `default:"0" split_words:"true"`      // KEEPALIVE_MAX_CONNECTION_IDLE, close connections idle for this long, 0 for no limit
+	KeepaliveMinTime               time.Duration `default:"0" split_words:"true"`      // KEEPALIVE_MIN_TIME, minimum client ping interval, 0 for the gRPC default of 5m
+	KeepalivePermitWithoutStream   bool          `default:"false" split_words:"true"`  // KEEPALIVE_PERMIT_WITHOUT_STREAM, allow client pings without active streams
+	KeepaliveTime                  time.Duration `default:"0" split_words:"true"`      // KEEPALIVE_TIME, ping idle clients after this long, 0 for the gRPC default of 2h
+	KeepaliveTimeout               time.Duration `default:"0" split_words:"true"`      // KEEPALIVE_TIMEOUT, wait this long for a ping ack, 0 for the gRPC default of 20s
+	LameduckFile                   string        `default:"" split_words:"true"`       // LAMEDUCK_FILE, report not-ready while this file exists
+	LameduckInterval               time.Duration `default:"1s" split_words:"true"`     // LAMEDUCK_INTERVAL, how often to check for the lameduck file
+	MaxRecvMsgSize                 int           `default:"0" split_words:"true"`      // MAX_RECV_MSG_SIZE, maximum gRPC message size received in bytes, 0 for the gRPC default of 4MB
+	MaxSendMsgSize                 int           `default:"0" split_words:"true"`      // MAX_SEND_MSG_SIZE, maximum gRPC message size sent in bytes, 0 for the gRPC default of no limit
+	ProxyProtocol                  bool          `default:"false" split_words:"true"`  // PROXY_PROTOCOL, read the client address from PROXY protocol headers sent by a load balancer
+	ReadHeaderTimeout              time.Duration `default:"10s" split_words:"true"`    // READ_HEADER_TIMEOUT, time allowed to read request headers, 0 for the read timeout
+	ReadTimeout                    time.Duration `default:"0" split_words:"true"`      // READ_TIMEOUT, 0 for the package ReadTimeout
+	RecvBufferSize                 int           `default:"0" split_words:"true"`      // RECV_BUFFER_SIZE, SO_RCVBUF in bytes, 0 for the system default
+	RestAddress                    string        `default:":80" split_words:"true"`    // REST_ADDRESS
+	ShutdownTimeout                time.Duration `default:"30s" split_words:"true"`    // SHUTDOWN_TIMEOUT, time allowed for in-flight requests to complete on shutdown
+	SendBufferSize                 int           `default:"0" split_words:"true"`      // SEND_BUFFER_SIZE, SO_SNDBUF in bytes, 0 for the system default
+	TLSCertFile                    string        `default:"" split_words:"true"`       // TLS_CERT_FILE, PEM certificate file to serve TLS with, plaintext if empty
+	TLSKeyFile                     string        `default:"" split_words:"true"`       // TLS_KEY_FILE, PEM private key file for TLS_CERT_FILE
+	WriteTimeout                   time.Duration `default:"0" split_words:"true"`      // WRITE_TIMEOUT, 0 for the package WriteTimeout
 }
 
 // New returns a new gRPC/REST service handler.
-func New(ctx context.Context, handler http.Handler, grpcServer *grpc.Server) (*Server, error) {
+func New(ctx context.Context, handler http.Handler, grpcServer *grpc.Server, opts ...Option) (*Server, error) {
+	options := newOptions(opts)
 	if nil == grpcServer {
 		err := errors.New("nil grpcServer value passed")
-		log.WithError(err).Error("cannot create service handlers")
+		logEntry(options.Logger).WithError(err).Error("cannot create service handlers")
+		return nil, err
+	}
+	if err := options.resolveTLS(); nil != err {
+		logEntry(options.Logger).WithError(err).Error("cannot create service handlers")
 		return nil, err
 	}
+	options.resolveTimeouts()
+
+	// serve gRPC-Web requests with the gRPC server.
+	if options.GRPCWeb || Conf.GrpcWeb {
+		handler = grpcWebHandler(grpcServer, handler)
+	}
+
+	// serve HTTP/2 cleartext, TLS connections negotiate HTTP/2 themselves.
+	if options.H2C || Conf.Http2Cleartext {
+		if nil == options.HTTPTLSConfig {
+			handler = h2c.NewHandler(handler, &http2.Server{
+				IdleTimeout:          options.IdleTimeout,
+				MaxConcurrentStreams: Conf.Http2MaxConcurrentStreams,
+			})
+		} else {
+			logEntry(options.Logger).Warn("h2c is not used when serving the REST gateway over TLS")
+		}
+	}
 
 	// create a cancelable server context to handle service shutdown.
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(ctx)
 
+	// canceled once the shutdown timeout elapses, or the shutdown completes.
+	stopCtx, stop := context.WithCancel(context.Background())
+	if nil != options.BaseContext {
+		options.BaseContext.set(ctx, stopCtx)
+	}
+
 	return &Server{
+		Logger:     options.Logger,
 		ctx:        ctx,
 		cancel:     cancel,
 		grpcServer: grpcServer,
+		health:     health.NewServer(),
 		httpServer: &http.Server{
-			Addr:         Conf.RestAddress,
-			Handler:      handler,
-			IdleTimeout:  IdleTimeout,
-			ReadTimeout:  ReadTimeout,
-			WriteTimeout: WriteTimeout,
+			Addr:              Conf.RestAddress,
+			Handler:           handler,
+			IdleTimeout:       options.IdleTimeout,
+			ReadHeaderTimeout: options.ReadHeaderTimeout,
+			ReadTimeout:       options.ReadTimeout,
+			TLSConfig:         options.HTTPTLSConfig,
+			WriteTimeout:      options.WriteTimeout,
 		},
-		wg: &sync.WaitGroup{},
+		opts:  options,
+		ready: make(chan struct{}),
+		stop:  stop,
+		wg:    &sync.WaitGroup{},
 	}, nil
 }
 
-// ListenAndServe starts the gRPC and REST gateway services.
-func (server *Server) ListenAndServe() {
+// Start starts the gRPC and REST gateway services in the background. Both
+// listeners are bound before anything is registered or served, so binding
+// errors, such as an address already in use, are returned to the caller and
+// Start can be retried. Calling Start again after it succeeded returns an
+// error. Errors serving after a successful start are logged and shut the
+// services down.
+//
+// The standard gRPC health service and reflection are registered here, so all
+// gRPC services must be registered before Start is called, either directly on
+// the gRPC server or in the RegisterServices callback, for health checks to
+// report them and for reflection clients such as grpcurl to see the complete
+// schema.
+func (server *Server) Start() error {
+	if !atomic.CompareAndSwapInt32(&server.started, 0, 1) {
+		return errors.New("server already started")
+	}
 
-	// enable service discovery.
-	reflection.Register(server.grpcServer)
+	// bind the listeners before serving anything, a failed Start can be
+	// retried.
+	serveGRPC, serveHTTP, err := server.listeners()
+	if nil != err {
+		atomic.StoreInt32(&server.started, 0)
+		return err
+	}
+
+	// register the services and enable service discovery, once.
+	server.registerOnce.Do(server.register)
+
+	// watch for the lameduck file.
+	if "" != Conf.LameduckFile {
+		go server.watchLameduck(Conf.LameduckFile, Conf.LameduckInterval)
+	}
 
 	// start the gRPC server.
-	server.wg.Add(1)
-	go func() {
-		defer server.wg.Done()
-		log.Info("starting gRPC server")
-		listener, err := net.Listen("tcp", Conf.GrpcAddress)
-		if nil != err {
-			server.cancel()
-			panic(errors.Wrap(err, "could not create TCP listener"))
-		}
-		if err := server.grpcServer.Serve(listener); nil != err {
-			server.cancel()
-			panic(errors.Wrap(err, "could not start gRPC server"))
-		}
-	}()
+	if nil != serveGRPC {
+		server.wg.Add(1)
+		go func() {
+			defer server.wg.Done()
+			server.logger().Info("starting gRPC server")
+			if err := serveGRPC(); nil != err {
+				server.logger().WithError(err).Error("gRPC server failed")
+				server.cancel()
+			}
+		}()
+	}
 
 	// start the HTTP server.
 	server.wg.Add(1)
 	go func() {
 		defer server.wg.Done()
-		log.Info("starting HTTP server")
-		if err := server.httpServer.ListenAndServe(); nil != err && http.ErrServerClosed != err {
+		server.logger().Info("starting HTTP server")
+		if err := serveHTTP(); nil != err && http.ErrServerClosed != err {
+			server.logger().WithError(err).Error("HTTP server failed")
 			server.cancel()
-			panic(errors.Wrap(err, "could not start HTTP server"))
 		}
 	}()
 
 	// activate the shutdown handler.
+	server.wg.Add(1)
 	go func() {
+		defer server.wg.Done()
 		<-server.ctx.Done()
 
-		// shutdown gRPC server
+		// report all services as not serving so clients stop routing new
+		// requests here while in-flight requests drain.
+		server.health.Shutdown()
+
+		stopped := &sync.WaitGroup{}
+		stopped.Add(2)
+		defer server.stop()
+		defer stopped.Wait()
+
+		// in single port mode, close the shared listener once both servers
+		// have stopped using it.
+		if nil != server.rootListener {
+			go func() {
+				stopped.Wait()
+				server.rootListener.Close()
+			}()
+		}
+
+		// last resort: terminate the process if shutdown hangs, e.g. on a
+		// handler blocked in a cgo call, so orchestrators don't wait on it
+		// forever. The timeout is generous on purpose: it is meant to catch
+		// stuck shutdowns, not slow ones.
+		if Conf.HardStop {
+			timer := time.AfterFunc(Conf.HardStopTimeout, func() {
+				server.logger().WithField("timeout", Conf.HardStopTimeout.String()).
+					Fatal("shutdown did not complete within the hard stop timeout, exiting")
+				// in case the logger's exit handler has been replaced.
+				os.Exit(1)
+			})
+			go func() {
+				stopped.Wait()
+				timer.Stop()
+			}()
+		}
+
+		// shutdown gRPC server, closing all connections if in-flight RPCs
+		// don't complete within the shutdown timeout.
 		go func() {
-			log.Info("stopping gRPC server")
-			server.grpcServer.GracefulStop()
-			log.Info("gRPC shutdown complete")
+			defer stopped.Done()
+			server.logger().Info("stopping gRPC server")
+			graceful := make(chan struct{})
+			go func() {
+				server.grpcServer.GracefulStop()
+				close(graceful)
+			}()
+			select {
+			case <-graceful:
+			case <-time.After(server.opts.ShutdownTimeout):
+				server.logger().WithField("timeout", server.opts.ShutdownTimeout.String()).
+					Warn("gRPC graceful shutdown timed out, closing all connections")
+				server.stop()
+				server.grpcServer.Stop()
+				<-graceful
+			}
+			server.logger().Info("gRPC shutdown complete")
 		}()
 
 		// shutdown HTTP server
 		go func() {
-			log.Info("stopping HTTP server")
-			ctx, cancel := context.WithTimeout(context.Background(), ReadTimeout)
+			defer stopped.Done()
+			server.logger().Info("stopping HTTP server")
+			ctx, cancel := context.WithTimeout(context.Background(), server.opts.ShutdownTimeout)
 			defer cancel() // don't let context leak; cancel on exit
 			if err := server.httpServer.Shutdown(ctx); nil != err {
-				log.WithError(err).Warn("Unable to gracefully handle all HTTP connections")
+				server.logger().WithError(err).Warn("Unable to gracefully handle all HTTP connections")
+				server.stop()
+				server.httpServer.Close()
 			}
-			log.Info("HTTP shutdown complete")
+			server.logger().Info("HTTP shutdown complete")
 		}()
 	}()
+
+	// the listeners are bound and accept connections.
+	close(server.ready)
+	return nil
+}
+
+// register registers the application services, then the standard health
+// service, channelz if enabled, and reflection.
+func (server *Server) register() {
+	if nil != server.RegisterServices {
+		server.RegisterServices(server.grpcServer)
+	}
+	if 0 == len(server.grpcServer.GetServiceInfo()) {
+		server.logger().Warn("no gRPC services registered before enabling reflection")
+	}
+
+	// standard health checks, for load balancers and orchestrators.
+	server.registerHealth()
+
+	// expose connection and subchannel state for debugging, e.g. with
+	// `grpcdebug <GRPC_ADDRESS> channelz channels`. It reveals peer addresses
+	// and connection details, so it is opt-in.
+	if Conf.Channelz {
+		server.logger().Info("registering the channelz service")
+		channelz.RegisterChannelzServiceToServer(server.grpcServer)
+	}
+
+	reflection.Register(server.grpcServer)
+}
+
+// Ready returns a channel that is closed once Start has bound the gRPC and
+// REST gateway listeners and the servers accept connections. It is never
+// closed if Start fails.
+func (server *Server) Ready() <-chan struct{} {
+	return server.ready
+}
+
+// ListenAndServe starts the gRPC and REST gateway services, see Start. It is
+// kept for backwards compatibility: errors starting the services are logged
+// and shut the server down instead of being returned.
+func (server *Server) ListenAndServe() {
+	if err := server.Start(); nil != err {
+		server.logger().WithError(err).Error("could not start services")
+		server.cancel()
+	}
 }
 
-// Shutdown gracefully shuts down the gRPC and REST services.
+// Shutdown gracefully shuts down the gRPC and REST services. It blocks until
+// both have stopped, which takes at most the shutdown timeout: connections
+// still active after it elapses are closed.
 func (server *Server) Shutdown() {
 	server.cancel()
 	server.wg.Wait()
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestStartRetryAfterBindError(t *testing.T) {
+	inUse, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	conf := Conf
+	defer func() { Conf = conf }()
+	Conf.GrpcNetwork = "tcp"
+	Conf.GrpcAddress = inUse.Addr().String()
+
+	srv, err := New(context.Background(), http.NotFoundHandler(), grpc.NewServer(), WithListeners(nil, httpListener))
+	if nil != err {
+		t.Fatal(err)
+	}
+	registered := 0
+	srv.RegisterServices = func(*grpc.Server) { registered++ }
+
+	if err := srv.Start(); nil == err {
+		t.Fatal("expected an error binding an address in use")
+	}
+	inUse.Close()
+	if err := srv.Start(); nil != err {
+		t.Fatalf("retried Start failed: %v", err)
+	}
+	defer srv.Shutdown()
+	<-srv.Ready()
+
+	if err := srv.Start(); nil == err {
+		t.Error("expected an error starting the server twice")
+	}
+	if 1 != registered {
+		t.Errorf("services registered %d times, want 1", registered)
+	}
+}
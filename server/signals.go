@@ -0,0 +1,71 @@
+package server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DefaultSignals returns the catchable signals that should trigger a
+// graceful shutdown: SIGINT, SIGTERM and SIGQUIT. SIGKILL and SIGSTOP can't
+// be caught, so passing them to signal.Notify has no effect.
+//
+//	interrupt := make(chan os.Signal, 1)
+//	signal.Notify(interrupt, server.DefaultSignals()...)
+func DefaultSignals() []os.Signal {
+	return []os.Signal{
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT,
+	}
+}
+
+// HandleSignals calls Shutdown when one of sigs, DefaultSignals if none, is
+// received, or when the server context is canceled. Signals that can't be
+// caught, SIGKILL and SIGSTOP, are ignored with a warning. The returned
+// channel is closed once the shutdown is complete, so the application can
+// wait for it before exiting:
+//
+//	done := tcpServer.HandleSignals()
+//	...
+//	<-done
+func (server *Server) HandleSignals(sigs ...os.Signal) <-chan struct{} {
+	if 0 == len(sigs) {
+		sigs = DefaultSignals()
+	}
+	catchable := []os.Signal{}
+	for _, sig := range sigs {
+		if uncatchable(sig) {
+			server.logger().WithField("signal", sig.String()).Warn("signal can't be caught, ignoring")
+			continue
+		}
+		catchable = append(catchable, sig)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	if 0 < len(catchable) {
+		signal.Notify(interrupt, catchable...)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer signal.Stop(interrupt)
+		select {
+		case sig := <-interrupt:
+			server.logger().WithField("signal", sig.String()).Info("signal received, shutting down")
+		case <-server.ctx.Done():
+		}
+		server.Shutdown()
+	}()
+	return done
+}
+
+// uncatchable reports whether a signal can't be caught.
+func uncatchable(sig os.Signal) bool {
+	for _, s := range uncatchableSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soheilhy/cmux"
+)
+
+// singlePortListeners binds a single listener on the HTTP address, or uses
+// the HTTP listener option, and returns the functions serving gRPC and HTTP on it.
+//
+// Without TLS, connections are multiplexed by protocol detection: HTTP/2
+// connections sending an "application/grpc" content type are served by the
+// gRPC server, everything else by the HTTP server.
+//
+// With TLS, a single handshake has to serve both protocols, so the HTTP
+// server terminates TLS with the HTTP TLS configuration and passes gRPC
+// requests to the gRPC server's ServeHTTP handler; the gRPC TLS configuration
+// isn't used. In this mode the HTTP server timeouts also apply to gRPC
+// streams.
+func (server *Server) singlePortListeners() (serveGRPC, serveHTTP func() error, err error) {
+	listener, err := listener(server.opts.HTTPListener, "", server.httpServer.Addr)
+	if nil != err {
+		return nil, nil, errors.Wrap(err, "could not create listener")
+	}
+	server.rootListener = listener
+	server.setAddrs(listener.Addr(), listener.Addr())
+	listener = server.proxyProtocol(listener)
+
+	if nil != server.httpServer.TLSConfig {
+		if nil != server.opts.GRPCTLSConfig && server.opts.GRPCTLSConfig != server.opts.HTTPTLSConfig {
+			server.logger().Warn("single port mode serves gRPC with the HTTP TLS configuration")
+		}
+		handler := server.httpServer.Handler
+		server.httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if 2 == r.ProtoMajor && isGRPC(r.Header.Get("Content-Type")) {
+				server.grpcServer.ServeHTTP(w, r)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+		return nil, func() error {
+			return server.serveHTTP(listener)
+		}, nil
+	}
+
+	mux := cmux.New(listener)
+	grpcListener := mux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	httpListener := mux.Match(cmux.Any())
+	go func() {
+		// returns once the listener is closed by the shutdown handler.
+		if err := mux.Serve(); nil != err && !isClosed(err) {
+			server.logger().WithError(err).Error("connection multiplexer failed")
+			server.cancel()
+		}
+	}()
+
+	serveGRPC = func() error {
+		return server.grpcServer.Serve(grpcListener)
+	}
+	serveHTTP = func() error {
+		return server.httpServer.Serve(httpListener)
+	}
+	return serveGRPC, serveHTTP, nil
+}
+
+// isClosed reports whether err is caused by a closed listener.
+func isClosed(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// isGRPC reports whether a content type is a native gRPC one,
+// "application/grpc" or "application/grpc+<codec>", as opposed to gRPC-Web.
+func isGRPC(contentType string) bool {
+	return "application/grpc" == contentType || strings.HasPrefix(contentType, "application/grpc+") || strings.HasPrefix(contentType, "application/grpc;")
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package server
+
+import "github.com/pkg/errors"
+
+// setSockoptBuffers returns an error if socket buffer sizes are requested,
+// they can't be set on this platform.
+func setSockoptBuffers(fd uintptr, recv, send int) error {
+	if recv > 0 || send > 0 {
+		return errors.New("socket buffer sizes are not supported on this platform")
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package server
+
+import "syscall"
+
+// setSockoptBuffers sets the socket receive and send buffer sizes. Values
+// less than or equal to zero are left at the system default.
+func setSockoptBuffers(fd uintptr, recv, send int) error {
+	if recv > 0 {
+		if err := syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, recv); nil != err {
+			return err
+		}
+	}
+	if send > 0 {
+		if err := syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, send); nil != err {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// started is the process start time, reported as the uptime by StatsHandler.
+var started = time.Now()
+
+// Stats defines the runtime statistics returned by StatsHandler. The field
+// names are stable.
+type Stats struct {
+	Goroutines    int     `json:"goroutines"`      // number of goroutines
+	HeapAlloc     uint64  `json:"heap_alloc"`      // bytes of allocated heap objects
+	HeapInuse     uint64  `json:"heap_inuse"`      // bytes in in-use heap spans
+	HeapObjects   uint64  `json:"heap_objects"`    // number of allocated heap objects
+	HeapSys       uint64  `json:"heap_sys"`        // bytes of heap memory obtained from the OS
+	TotalAlloc    uint64  `json:"total_alloc"`     // cumulative bytes allocated for heap objects
+	Sys           uint64  `json:"sys"`             // total bytes of memory obtained from the OS
+	NumGC         uint32  `json:"num_gc"`          // number of completed GC cycles
+	PauseTotalNs  uint64  `json:"pause_total_ns"`  // cumulative GC pause time in nanoseconds
+	LastGC        string  `json:"last_gc"`         // time the last GC cycle finished (RFC 3339), empty if none has run
+	GCCPUFraction float64 `json:"gc_cpu_fraction"` // fraction of available CPU time used by the GC since the program started
+	Uptime        string  `json:"uptime"`          // time since the process started, e.g. "1h2m3s"
+	UptimeSeconds float64 `json:"uptime_seconds"`  // time since the process started in seconds
+}
+
+// StatsHandler serves the current runtime Stats as JSON, for quick triage
+// without a profiler. It is opt-in: mount it on an internal router, e.g. at
+// "/debug/stats", as it exposes process internals. Reading the memory
+// statistics briefly stops the world, so it should not be polled frequently.
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+	uptime := time.Since(started)
+
+	stats := Stats{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		HeapObjects:   mem.HeapObjects,
+		HeapSys:       mem.HeapSys,
+		TotalAlloc:    mem.TotalAlloc,
+		Sys:           mem.Sys,
+		NumGC:         mem.NumGC,
+		PauseTotalNs:  mem.PauseTotalNs,
+		GCCPUFraction: mem.GCCPUFraction,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: uptime.Seconds(),
+	}
+	if mem.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(mem.LastGC)).Format(time.RFC3339Nano)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// uncatchableSignals lists the signals that can't be caught or handled.
+var uncatchableSignals = []os.Signal{syscall.SIGKILL, syscall.SIGSTOP}